@@ -1,6 +1,10 @@
 package main
 
 import (
+	// The runtime image has no zoneinfo; profile timezones are validated
+	// against the embedded copy.
+	_ "time/tzdata"
+
 	"github.com/dorik33/DeNet/internal/app"
 )
 
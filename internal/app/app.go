@@ -1,51 +1,117 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/events"
 	"github.com/dorik33/DeNet/internal/handlers"
+	"github.com/dorik33/DeNet/internal/leaderboard"
 	"github.com/dorik33/DeNet/internal/logger"
+	"github.com/dorik33/DeNet/internal/mailer"
 	"github.com/dorik33/DeNet/internal/middleware/jwt"
 	"github.com/dorik33/DeNet/internal/middleware/log"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/ledgerrepo"
 	"github.com/dorik33/DeNet/internal/repository/store"
 	"github.com/dorik33/DeNet/internal/repository/taskrepo"
+	"github.com/dorik33/DeNet/internal/repository/tokenrepo"
 	"github.com/dorik33/DeNet/internal/repository/userrepo"
+	"github.com/dorik33/DeNet/internal/repository/webhookrepo"
+	"github.com/dorik33/DeNet/internal/service"
+	"github.com/dorik33/DeNet/internal/service/session"
+	"github.com/dorik33/DeNet/internal/service/task"
 	"github.com/dorik33/DeNet/internal/service/user"
+	"github.com/dorik33/DeNet/internal/service/webhook"
+	"github.com/dorik33/DeNet/internal/signing"
 	"github.com/go-chi/chi/v5"
 )
 
 type App struct {
-	logger   *slog.Logger
-	cfg      *config.Config
-	router   *chi.Mux
-	handlers handlers.Handlers
+	logger      *slog.Logger
+	cfg         *config.Config
+	router      *chi.Mux
+	handlers    handlers.Handlers
+	userService service.UserService
+	sessions    service.SessionService
+	keys        *signing.KeySet
+	leaderboard *leaderboard.CachedUserRepository
 }
 
 func InitApp() *App {
 	cfg := config.LoadConfig()
 	logger := logger.InitLogger()
+	keys, err := signing.LoadKeySet(cfg)
+	if err != nil {
+		logger.Error("failed to load signing keys", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	// Link tokens are only as strong as their HMAC key; an empty one would
+	// let anyone link their partner account to another user.
+	if cfg.WebhookCfg.LinkSecret == "" {
+		logger.Error("WEBHOOK_LINK_SECRET is required")
+		os.Exit(1)
+	}
+	// The same goes for email verification links, which name a sequential
+	// row id.
+	if cfg.EmailCfg.TokenSecret == "" {
+		logger.Error("EMAIL_TOKEN_SECRET is required")
+		os.Exit(1)
+	}
+
+	mail, err := mailer.New(cfg, logger)
+	if err != nil {
+		logger.Error("failed to set up mailer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
 	pool, err := store.NewConnection(cfg)
 	if err != nil {
 		logger.Error("failed to connect to database", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
-	userRepo := userrepo.NewUserRepository(pool, logger)
+	var (
+		userRepo         repository.UserRepository = userrepo.NewUserRepository(pool, logger)
+		leaderboardCache *leaderboard.CachedUserRepository
+	)
+	if cfg.LeaderboardCfg.Cache {
+		leaderboardCache = leaderboard.NewCachedUserRepository(userRepo, leaderboard.NewMemoryStore(), logger)
+		userRepo = leaderboardCache
+	}
 	taskRepo := taskrepo.NewTaskRepository(pool, logger)
+	ledgerRepo := ledgerrepo.NewLedgerRepository(pool, logger)
+	tokenRepo := tokenrepo.NewTokenRepository(pool, logger)
+	webhookRepo := webhookrepo.NewWebhookRepository(pool, logger)
+	txManager := store.NewTxManager(pool)
+	bus := events.NewBus()
+
+	sessionService := session.NewSessionService(userRepo, tokenRepo, logger, cfg)
 
-	service := user.NewUserService(userRepo, taskRepo, logger, cfg)
+	userService := user.NewUserService(userRepo, taskRepo, ledgerRepo, tokenRepo, txManager, sessionService, bus, mail, keys, logger, cfg)
 
-	handlers := handlers.NewHandlers(service, logger)
+	taskService := task.NewTaskService(taskRepo, txManager, logger)
+
+	webhookService := webhook.NewWebhookService(webhookRepo, userService, txManager, logger, cfg)
+
+	handlers := handlers.NewHandlers(userService, sessionService, taskService, webhookService, bus, cfg.LeaderboardCfg.StreamsPerUser, keys, logger)
 
 	app := App{
-		logger:   logger,
-		cfg:      cfg,
-		router:   chi.NewMux(),
-		handlers: handlers,
+		logger:      logger,
+		cfg:         cfg,
+		router:      chi.NewMux(),
+		handlers:    handlers,
+		userService: userService,
+		sessions:    sessionService,
+		keys:        keys,
+		leaderboard: leaderboardCache,
 	}
 
 	return &app
@@ -53,6 +119,8 @@ func InitApp() *App {
 
 func (app *App) Run() {
 	app.setupRoutes()
+	go app.runReconciliation()
+	go app.runLeaderboardRebuild()
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", app.cfg.ServerCfg.HttpPort),
@@ -70,19 +138,101 @@ func (app *App) Run() {
 	}
 }
 
+// runReconciliation periodically recomputes cached balances from the points
+// ledger. A zero interval disables it.
+func (app *App) runReconciliation() {
+	if app.cfg.ReconcileInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.cfg.ReconcileInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := app.userService.ReconcilePoints(context.Background()); err != nil {
+			app.logger.Error("points reconciliation failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// runLeaderboardRebuild loads the leaderboard cache and then reloads it from
+// the database on every tick. A zero interval loads it only once.
+func (app *App) runLeaderboardRebuild() {
+	if app.leaderboard == nil {
+		return
+	}
+
+	if err := app.leaderboard.Rebuild(context.Background()); err != nil {
+		app.logger.Error("leaderboard cache rebuild failed", slog.String("error", err.Error()))
+	}
+	if app.cfg.LeaderboardCfg.RebuildInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.cfg.LeaderboardCfg.RebuildInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := app.leaderboard.Rebuild(context.Background()); err != nil {
+			app.logger.Error("leaderboard cache rebuild failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
 func (app *App) setupRoutes() {
 	app.router.Group(func(r chi.Router) {
 		r.Use(log.LoggingMiddleware(app.logger))
 		r.Post("/register", app.handlers.RegisterHandler())
 		r.Post("/login", app.handlers.LoginHandler())
+		r.Post("/auth/refresh", app.handlers.RefreshHandler())
+		r.Post("/email/verify", app.handlers.VerifyEmailHandler())
+		r.Get("/.well-known/jwks.json", app.handlers.JWKSHandler())
 		r.Get("/users/leaderboard", app.handlers.LeaderboardHandler())
+		r.Get("/tasks", app.handlers.ListTasksHandler())
+		r.Post("/webhooks/tasks/{provider}", app.handlers.WebhookTaskHandler())
+		r.Post("/webhooks/accounts/{provider}", app.handlers.WebhookAccountHandler())
 	})
 
 	app.router.Group(func(r chi.Router) {
 		r.Use(log.LoggingMiddleware(app.logger))
-		r.Use(jwt.AuthMiddleware(app.logger, app.cfg))
+		r.Use(jwt.AuthMiddleware(app.logger, app.keys, app.sessions))
+		r.Post("/logout", app.handlers.LogoutHandler())
+		r.Post("/users/{id}/sessions/revoke-all", app.handlers.RevokeSessionsHandler())
 		r.Post("/users/{id}/referrer", app.handlers.SetReferrerHandler())
+		r.Put("/users/{id}/referral-code", app.handlers.SetReferralCodeHandler())
+		r.Get("/users/{id}/profile", app.handlers.GetProfileHandler())
+		r.Patch("/users/{id}/profile", app.handlers.UpdateProfileHandler())
+		r.Post("/users/{id}/password", app.handlers.ChangePasswordHandler())
+		r.Post("/users/{id}/email", app.handlers.ChangeEmailHandler())
+		r.Post("/users/{id}/email/verification", app.handlers.ResendVerificationHandler())
+		r.Get("/users/{id}/referrals", app.handlers.ReferralsHandler())
+		r.Get("/users/{id}/referrals/stats", app.handlers.ReferralStatsHandler())
+		r.Get("/users/{id}/rank", app.handlers.RankHandler())
+		r.Get("/users/{id}/leaderboard/around", app.handlers.LeaderboardAroundHandler())
+		r.Get("/users/leaderboard/stream", app.handlers.LeaderboardStreamHandler())
 		r.Get("/users/{id}/status", app.handlers.StatusHandler())
 		r.Post("/users/{id}/tasks/complete", app.handlers.CompleteTaskHandler())
+		r.Get("/users/{id}/transactions", app.handlers.TransactionsHandler())
+		r.Get("/users/{id}/tasks", app.handlers.UserTasksHandler())
+		r.Post("/users/{id}/accounts/{provider}/link-token", app.handlers.LinkTokenHandler())
+	})
+
+	app.router.Group(func(r chi.Router) {
+		r.Use(log.LoggingMiddleware(app.logger))
+		r.Use(jwt.AuthMiddleware(app.logger, app.keys, app.sessions))
+		r.Use(jwt.RequireRole(app.logger, models.RoleAdmin))
+		r.Put("/admin/users/{id}/role", app.handlers.SetRoleHandler())
+		r.Post("/admin/tasks", app.handlers.CreateTaskHandler())
+		r.Put("/admin/tasks/{taskID}", app.handlers.UpdateTaskHandler())
+		r.Delete("/admin/tasks/{taskID}", app.handlers.DeleteTaskHandler())
+	})
+
+	app.router.Group(func(r chi.Router) {
+		r.Use(log.LoggingMiddleware(app.logger))
+		r.Use(jwt.AuthMiddleware(app.logger, app.keys, app.sessions))
+		r.Use(jwt.RequireRole(app.logger, models.RoleModerator, models.RoleAdmin))
+		r.Get("/moderation/submissions", app.handlers.ListSubmissionsHandler())
+		r.Post("/moderation/submissions/{submissionID}/approve", app.handlers.ApproveSubmissionHandler())
+		r.Post("/moderation/submissions/{submissionID}/reject", app.handlers.RejectSubmissionHandler())
 	})
 }
@@ -9,10 +9,67 @@ import (
 )
 
 type Config struct {
-	SecretKey   string        `env:"JWT_SECRET_KEY"`
-	JwtTTL      time.Duration `env:"JWT_TTL"`
-	DatabaseCfg database
-	ServerCfg   server
+	SecretKey         string        `env:"JWT_SECRET_KEY"`
+	JwtTTL            time.Duration `env:"JWT_TTL"`
+	RefreshTTL        time.Duration `env:"JWT_REFRESH_TTL"`
+	RevocationTTL     time.Duration `env:"JWT_REVOCATION_CACHE_TTL"`
+	ReconcileInterval time.Duration `env:"LEDGER_RECONCILE_INTERVAL"`
+	DatabaseCfg       database
+	ServerCfg         server
+	SigningCfg        signing
+	WebhookCfg        webhook
+	ReferralCfg       referral
+	LeaderboardCfg    leaderboard
+	EmailCfg          email
+}
+
+type email struct {
+	// TokenSecret signs email verification links.
+	TokenSecret string        `env:"EMAIL_TOKEN_SECRET"`
+	TokenTTL    time.Duration `env:"EMAIL_TOKEN_TTL"`
+	// VerifyURL is the page the link in the email points to; the token is
+	// appended to it.
+	VerifyURL string `env:"EMAIL_VERIFY_URL"`
+	// Mailer is how email is delivered: "smtp", "file" or "log".
+	Mailer       string `env:"MAILER"`
+	MailerFile   string `env:"MAILER_FILE_PATH"`
+	From         string `env:"MAIL_FROM"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     string `env:"SMTP_PORT"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+}
+
+type leaderboard struct {
+	// Cache serves the all-time leaderboard from memory instead of the
+	// users table.
+	Cache           bool          `env:"LEADERBOARD_CACHE"`
+	RebuildInterval time.Duration `env:"LEADERBOARD_REBUILD_INTERVAL"`
+	// StreamsPerUser caps the open leaderboard streams of a single user.
+	StreamsPerUser int `env:"LEADERBOARD_STREAMS_PER_USER"`
+}
+
+type referral struct {
+	ReferrerBonus int `env:"REFERRAL_REFERRER_BONUS"`
+	RefereeBonus  int `env:"REFERRAL_REFEREE_BONUS"`
+	// CommissionTiers holds the share in percent paid to each level of
+	// referrers, starting with the direct referrer.
+	CommissionTiers []int `env:"REFERRAL_COMMISSION_TIERS" env-separator:","`
+}
+
+type webhook struct {
+	Secrets   map[string]string `env:"WEBHOOK_SECRETS"`
+	Tolerance time.Duration     `env:"WEBHOOK_TOLERANCE"`
+	// LinkSecret signs the tokens users hand to partners to link accounts.
+	LinkSecret string        `env:"WEBHOOK_LINK_SECRET"`
+	LinkTTL    time.Duration `env:"WEBHOOK_LINK_TTL"`
+}
+
+type signing struct {
+	Algorithm      string            `env:"JWT_SIGNING_ALG"`
+	KeyID          string            `env:"JWT_SIGNING_KEY_ID"`
+	PrivateKeyPath string            `env:"JWT_PRIVATE_KEY_PATH"`
+	VerifyKeys     map[string]string `env:"JWT_VERIFY_KEYS"`
 }
 
 type database struct {
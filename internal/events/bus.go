@@ -0,0 +1,81 @@
+// Package events is an in-process publish/subscribe bus for notifying
+// long-lived connections about changes made by other requests.
+package events
+
+import (
+	"sync"
+)
+
+type Kind string
+
+const (
+	// KindPointsChanged is published after a transaction that changed a
+	// user's balance commits.
+	KindPointsChanged Kind = "points_changed"
+)
+
+type Event struct {
+	Kind   Kind
+	UserID int
+	Delta  int
+}
+
+// Publisher is the side of the bus services depend on.
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Bus fans events out to every subscriber. Publishing never blocks: a
+// subscriber whose buffer is full misses the event, so subscribers should
+// treat events as hints to reload state rather than as a complete log.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*Subscription]struct{})}
+}
+
+type Subscription struct {
+	bus    *Bus
+	events chan Event
+	once   sync.Once
+}
+
+// Subscribe registers a subscriber with room for buffer undelivered events.
+// The subscription must be closed once it is no longer read.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{bus: b, events: make(chan Event, max(buffer, 1))}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscribers, s)
+		s.bus.mu.Unlock()
+		close(s.events)
+	})
+}
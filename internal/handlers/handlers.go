@@ -3,34 +3,92 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/dorik33/DeNet/internal/events"
+	"github.com/dorik33/DeNet/internal/middleware/jwt"
 	"github.com/dorik33/DeNet/internal/models"
 	"github.com/dorik33/DeNet/internal/service"
 	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/signing"
 	"github.com/go-chi/chi/v5"
 )
 
 type Handlers interface {
 	RegisterHandler() http.HandlerFunc
 	LoginHandler() http.HandlerFunc
+	RefreshHandler() http.HandlerFunc
+	LogoutHandler() http.HandlerFunc
+	RevokeSessionsHandler() http.HandlerFunc
+	JWKSHandler() http.HandlerFunc
+	SetRoleHandler() http.HandlerFunc
 	LeaderboardHandler() http.HandlerFunc
+	RankHandler() http.HandlerFunc
+	LeaderboardAroundHandler() http.HandlerFunc
+	LeaderboardStreamHandler() http.HandlerFunc
 	SetReferrerHandler() http.HandlerFunc
+	SetReferralCodeHandler() http.HandlerFunc
+	GetProfileHandler() http.HandlerFunc
+	UpdateProfileHandler() http.HandlerFunc
+	ChangePasswordHandler() http.HandlerFunc
+	ChangeEmailHandler() http.HandlerFunc
+	VerifyEmailHandler() http.HandlerFunc
+	ResendVerificationHandler() http.HandlerFunc
+	ReferralsHandler() http.HandlerFunc
+	ReferralStatsHandler() http.HandlerFunc
 	StatusHandler() http.HandlerFunc
 	CompleteTaskHandler() http.HandlerFunc
+	TransactionsHandler() http.HandlerFunc
+	ListTasksHandler() http.HandlerFunc
+	UserTasksHandler() http.HandlerFunc
+	CreateTaskHandler() http.HandlerFunc
+	UpdateTaskHandler() http.HandlerFunc
+	DeleteTaskHandler() http.HandlerFunc
+	ListSubmissionsHandler() http.HandlerFunc
+	ApproveSubmissionHandler() http.HandlerFunc
+	RejectSubmissionHandler() http.HandlerFunc
+	WebhookTaskHandler() http.HandlerFunc
+	WebhookAccountHandler() http.HandlerFunc
+	LinkTokenHandler() http.HandlerFunc
 }
 
 type handler struct {
-	userService service.UserService
-	logger      *slog.Logger
+	userService    service.UserService
+	sessionService service.SessionService
+	taskService    service.TaskService
+	webhookService service.WebhookService
+	bus            *events.Bus
+	streams        *streamLimiter
+	snapshots      *snapshotCache
+	keys           *signing.KeySet
+	logger         *slog.Logger
 }
 
-func NewHandlers(userService service.UserService, logger *slog.Logger) Handlers {
+func NewHandlers(
+	userService service.UserService,
+	sessionService service.SessionService,
+	taskService service.TaskService,
+	webhookService service.WebhookService,
+	bus *events.Bus,
+	streamsPerUser int,
+	keys *signing.KeySet,
+	logger *slog.Logger,
+) Handlers {
 	return &handler{
-		userService: userService,
-		logger:      logger,
+		userService:    userService,
+		sessionService: sessionService,
+		taskService:    taskService,
+		webhookService: webhookService,
+		bus:            bus,
+		streams:        newStreamLimiter(streamsPerUser),
+		snapshots:      newSnapshotCache(),
+		keys:           keys,
+		logger:         logger,
 	}
 }
 
@@ -58,12 +116,20 @@ func (h *handler) RegisterHandler() http.HandlerFunc {
 			return
 		}
 
-		err := h.userService.Register(r.Context(), req.Email, req.Password)
+		err := h.userService.Register(r.Context(), req.Email, req.Password, req.ReferralCode)
 		if err != nil {
 			if errors.Is(err, serviceerrors.ErrUserAlreadyExists) {
 				http.Error(w, "User already exists", http.StatusConflict)
 				return
 			}
+			if errors.Is(err, serviceerrors.ErrInvalidEmail) {
+				http.Error(w, "Invalid email", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferrerNotFound) {
+				http.Error(w, "Referral code not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to register", http.StatusBadRequest)
 			return
 		}
@@ -96,7 +162,7 @@ func (h *handler) LoginHandler() http.HandlerFunc {
 			return
 		}
 
-		token, err := h.userService.Login(r.Context(), req.Email, req.Password)
+		tokens, err := h.userService.Login(r.Context(), req.Email, req.Password)
 		if err != nil {
 			if errors.Is(err, serviceerrors.ErrUserNotFound) {
 				http.Error(w, "User not found", http.StatusNotFound)
@@ -112,38 +178,129 @@ func (h *handler) LoginHandler() http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"token": token})
+		json.NewEncoder(w).Encode(tokens)
 	}
 }
 
-func (h *handler) LeaderboardHandler() http.HandlerFunc {
+func (h *handler) RefreshHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodPost {
 			h.logger.Info("Invalid method")
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		limit := 10
-		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
-			if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
-				limit = l
+		var req models.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.RefreshToken == "" {
+			http.Error(w, "Refresh token is required", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := h.userService.RefreshTokens(r.Context(), req.RefreshToken)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrTokenReused) {
+				http.Error(w, "Refresh token reuse detected, please log in again", http.StatusUnauthorized)
+				return
 			}
+			if errors.Is(err, serviceerrors.ErrInvalidToken) {
+				http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+				return
+			}
+			h.logger.Error("Failed to refresh tokens", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
 
-		users, err := h.userService.GetLeaderboard(r.Context(), limit)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+func (h *handler) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := jwt.ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req models.LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err := h.sessionService.Logout(r.Context(), claims, req.RefreshToken)
 		if err != nil {
-			h.logger.Error("Failed to get leaderboard", slog.String("error", err.Error()))
+			h.logger.Error("Failed to logout", slog.String("error", err.Error()))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(users)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+	}
+}
+
+func (h *handler) RevokeSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDStr := chi.URLParam(r, "id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		err = h.sessionService.RevokeAll(r.Context(), userID)
 		if err != nil {
-			h.logger.Error("Failed to encode leaderboard response", slog.String("error", err.Error()))
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to revoke sessions", slog.String("error", err.Error()))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "All sessions revoked"})
+	}
+}
+
+func (h *handler) JWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(h.keys.JWKS())
+		if err != nil {
+			h.logger.Error("Failed to encode jwks response", slog.String("error", err.Error()))
 		}
 	}
 }
@@ -170,10 +327,34 @@ func (h *handler) SetReferrerHandler() http.HandlerFunc {
 			return
 		}
 
-		err = h.userService.SetReferrer(r.Context(), userID, req.ReferrerID)
+		err = h.userService.SetReferrer(r.Context(), userID, req.ReferralCode)
 		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidCode) {
+				http.Error(w, "Referral code is required", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferrerNotFound) {
+				http.Error(w, "Referral code not found", http.StatusNotFound)
+				return
+			}
 			if errors.Is(err, serviceerrors.ErrUserNotFound) {
-				http.Error(w, "Referrer not found", http.StatusNotFound)
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrSelfReferral) {
+				http.Error(w, "You cannot use your own referral code", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferrerAlreadySet) {
+				http.Error(w, "Referrer already set", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferralCycle) {
+				http.Error(w, "Referrer was invited by you", http.StatusUnprocessableEntity)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferrerTooNew) {
+				http.Error(w, "Referrer registered after you", http.StatusUnprocessableEntity)
 				return
 			}
 			h.logger.Error("Failed to set referrer", slog.String("error", err.Error()))
@@ -187,6 +368,52 @@ func (h *handler) SetReferrerHandler() http.HandlerFunc {
 	}
 }
 
+func (h *handler) SetReferralCodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDStr := chi.URLParam(r, "id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.SetReferralCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		code, err := h.userService.SetReferralCode(r.Context(), userID, req.Code)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidCode) {
+				http.Error(w, "Code must be 4-20 letters, digits, '-' or '_'", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrReferralCodeTaken) {
+				http.Error(w, "Referral code already taken", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to set referral code", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"referral_code": code})
+	}
+}
+
 func (h *handler) StatusHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -243,23 +470,185 @@ func (h *handler) CompleteTaskHandler() http.HandlerFunc {
 			return
 		}
 
-		err = h.userService.CompleteTask(r.Context(), userID, req.TaskID)
+		submission, err := h.userService.CompleteTask(r.Context(), userID, req.TaskID, req.Proof)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrPartnerOnly) {
+				http.Error(w, "Task is confirmed by the partner", http.StatusForbidden)
+				return
+			}
+			h.writeCompletionError(w, err)
+			return
+		}
+
+		if submission.Status == models.SubmissionPending {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]any{"message": "Task submitted for review", "submission_id": submission.ID})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Task completed successfully"})
+	}
+}
+
+// writeCompletionError maps errors returned by task completion to HTTP
+// responses.
+func (h *handler) writeCompletionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, serviceerrors.ErrTaskNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrProofRequired) {
+		http.Error(w, "Task requires a proof", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrInvalidProof) {
+		http.Error(w, "Invalid proof", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrTaskAlreadyDone) {
+		http.Error(w, "Task already completed", http.StatusConflict)
+		return
+	}
+	var cooldown *serviceerrors.CooldownError
+	if errors.As(err, &cooldown) {
+		retryAfter := int(math.Ceil(time.Until(cooldown.RetryAfter).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Task is on cooldown, retry after "+cooldown.RetryAfter.UTC().Format(time.RFC3339), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrTaskArchived) || errors.Is(err, serviceerrors.ErrTaskEnded) {
+		http.Error(w, "Task is no longer available", http.StatusGone)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrTaskCapReached) {
+		http.Error(w, "Task completion limit reached", http.StatusGone)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrTaskNotStarted) {
+		http.Error(w, "Task is not available yet", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrTaskLocked) {
+		http.Error(w, "Task is locked, complete the required tasks first", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrEmailNotVerified) {
+		http.Error(w, "Email is not verified", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, serviceerrors.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	h.logger.Error("Failed to complete task", slog.String("error", err.Error()))
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func (h *handler) TransactionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDStr := chi.URLParam(r, "id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		limit := 20
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			if l, err := strconv.Atoi(limitParam); err == nil && l > 0 && l <= 100 {
+				limit = l
+			}
+		}
+
+		var cursor int64
+		if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+			cursor, err = strconv.ParseInt(cursorParam, 10, 64)
+			if err != nil || cursor <= 0 {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := h.userService.GetTransactions(r.Context(), userID, cursor, limit)
+		if err != nil {
+			h.logger.Error("Failed to get transactions", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			h.logger.Error("Failed to encode transactions response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) SetRoleHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDStr := chi.URLParam(r, "id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.SetRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err = h.userService.SetRole(r.Context(), userID, req.Role)
 		if err != nil {
-			if errors.Is(err, serviceerrors.ErrTaskNotFound) {
-				http.Error(w, "Task not found", http.StatusNotFound)
+			if errors.Is(err, serviceerrors.ErrInvalidRole) {
+				http.Error(w, "Invalid role", http.StatusBadRequest)
 				return
 			}
-			if errors.Is(err, serviceerrors.ErrTaskAlreadyDone) {
-				http.Error(w, "Task already completed", http.StatusConflict)
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
 				return
 			}
-			h.logger.Error("Failed to complete task", slog.String("error", err.Error()))
+			h.logger.Error("Failed to set role", slog.String("error", err.Error()))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
+		// Tokens carry the role, so the old ones must not outlive the change.
+		err = h.sessionService.RevokeAll(r.Context(), userID)
+		if err != nil {
+			h.logger.Error("Failed to revoke sessions after role change", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		claims, _ := jwt.ClaimsFromContext(r.Context())
+		h.logger.Info("Role changed",
+			slog.String("component", "audit"),
+			slog.String("admin_id", claims.Subject),
+			slog.Int("user_id", userID),
+			slog.String("role", string(req.Role)),
+		)
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Task completed successfully"})
+		json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully"})
 	}
 }
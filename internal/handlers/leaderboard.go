@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+	defaultAroundSize       = 5
+	maxAroundSize           = 50
+)
+
+// parsePeriod reads the period query parameter, which defaults to the
+// lifetime leaderboard.
+func parsePeriod(r *http.Request) models.Period {
+	if period := r.URL.Query().Get("period"); period != "" {
+		return models.Period(period)
+	}
+	return models.PeriodAll
+}
+
+// parseLeaderboardQuery reads period, limit and either offset or cursor.
+func parseLeaderboardQuery(r *http.Request) (models.LeaderboardQuery, error) {
+	query := r.URL.Query()
+	lq := models.LeaderboardQuery{Period: parsePeriod(r), Limit: defaultLeaderboardLimit}
+
+	if limitParam := query.Get("limit"); limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l <= 0 || l > maxLeaderboardLimit {
+			return lq, errors.New("limit must be between 1 and " + strconv.Itoa(maxLeaderboardLimit))
+		}
+		lq.Limit = l
+	}
+	if offsetParam := query.Get("offset"); offsetParam != "" {
+		o, err := strconv.Atoi(offsetParam)
+		if err != nil || o < 0 {
+			return lq, errors.New("offset must not be negative")
+		}
+		lq.Offset = o
+	}
+	if cursorParam := query.Get("cursor"); cursorParam != "" {
+		if lq.Offset != 0 {
+			return lq, errors.New("cursor and offset cannot be combined")
+		}
+		cursor, err := models.ParseLeaderboardCursor(cursorParam)
+		if err != nil {
+			return lq, err
+		}
+		lq.Cursor = &cursor
+	}
+
+	return lq, nil
+}
+
+func (h *handler) LeaderboardHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query, err := parseLeaderboardQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := h.userService.GetLeaderboard(r.Context(), query)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "period must be one of day, week, month, all", http.StatusBadRequest)
+				return
+			}
+			h.logger.Error("Failed to get leaderboard", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			h.logger.Error("Failed to encode leaderboard response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) RankHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		rank, err := h.userService.GetRank(r.Context(), userID, parsePeriod(r))
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "period must be one of day, week, month, all", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to get rank", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(rank)
+		if err != nil {
+			h.logger.Error("Failed to encode rank response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) LeaderboardAroundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		n := defaultAroundSize
+		if nParam := r.URL.Query().Get("n"); nParam != "" {
+			v, err := strconv.Atoi(nParam)
+			if err != nil || v < 0 || v > maxAroundSize {
+				http.Error(w, "n must be between 0 and "+strconv.Itoa(maxAroundSize), http.StatusBadRequest)
+				return
+			}
+			n = v
+		}
+
+		around, err := h.userService.GetLeaderboardAround(r.Context(), userID, n, parsePeriod(r))
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "period must be one of day, week, month, all", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to get leaderboard around user", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(around)
+		if err != nil {
+			h.logger.Error("Failed to encode leaderboard response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dorik33/DeNet/internal/middleware/jwt"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) ListSubmissionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		status := models.SubmissionPending
+		if statusParam := query.Get("status"); statusParam != "" {
+			status = models.SubmissionStatus(statusParam)
+		}
+
+		limit := 20
+		if limitParam := query.Get("limit"); limitParam != "" {
+			l, err := strconv.Atoi(limitParam)
+			if err != nil || l <= 0 || l > 100 {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			limit = l
+		}
+		offset := 0
+		if offsetParam := query.Get("offset"); offsetParam != "" {
+			o, err := strconv.Atoi(offsetParam)
+			if err != nil || o < 0 {
+				http.Error(w, "offset must not be negative", http.StatusBadRequest)
+				return
+			}
+			offset = o
+		}
+
+		page, err := h.userService.ListSubmissions(r.Context(), status, limit, offset)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "Invalid status", http.StatusBadRequest)
+				return
+			}
+			h.logger.Error("Failed to list submissions", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			h.logger.Error("Failed to encode submissions response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) ApproveSubmissionHandler() http.HandlerFunc {
+	return h.reviewSubmission(true)
+}
+
+func (h *handler) RejectSubmissionHandler() http.HandlerFunc {
+	return h.reviewSubmission(false)
+}
+
+func (h *handler) reviewSubmission(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		submissionID, err := strconv.ParseInt(chi.URLParam(r, "submissionID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid submission ID", http.StatusBadRequest)
+			return
+		}
+
+		claims, ok := jwt.ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		moderatorID, err := claims.UserID()
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req models.ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		submission, err := h.userService.ReviewSubmission(r.Context(), moderatorID, submissionID, approve, req.Comment)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrSubmissionNotFound) {
+				http.Error(w, "Pending submission not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrSelfReview) {
+				http.Error(w, "Cannot review own submission", http.StatusForbidden)
+				return
+			}
+			h.logger.Error("Failed to review submission", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		h.logger.Info("Submission reviewed",
+			slog.String("component", "audit"),
+			slog.Int("moderator_id", moderatorID),
+			slog.Int64("submission_id", submissionID),
+			slog.String("status", string(submission.Status)),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(submission)
+		if err != nil {
+			h.logger.Error("Failed to encode submission response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
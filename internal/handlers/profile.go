@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) GetProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		profile, err := h.userService.GetProfile(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to get profile", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(profile)
+		if err != nil {
+			h.logger.Error("Failed to encode profile response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) UpdateProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		profile, err := h.userService.UpdateProfile(r.Context(), userID, req)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidProfile) {
+				http.Error(w, "Invalid profile: display_name must be up to 32 printable characters, avatar_url an http(s) URL, locale a language tag and timezone an IANA zone", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrDisplayNameTaken) {
+				http.Error(w, "Display name already taken", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to update profile", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(profile)
+		if err != nil {
+			h.logger.Error("Failed to encode profile response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) ChangePasswordHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.CurrentPassword == "" || req.NewPassword == "" {
+			http.Error(w, "Current and new password are required", http.StatusBadRequest)
+			return
+		}
+		if req.NewPassword != req.ConfirmPassword {
+			http.Error(w, "Passwords do not match", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := h.userService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidPassword) {
+				http.Error(w, "Invalid password", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to change password", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(tokens)
+		if err != nil {
+			h.logger.Error("Failed to encode tokens response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) ChangeEmailHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.ChangeEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err = h.userService.RequestEmailChange(r.Context(), userID, req.Email, req.Password)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidEmail) {
+				http.Error(w, "Invalid email", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrInvalidPassword) {
+				http.Error(w, "Invalid password", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserAlreadyExists) {
+				http.Error(w, "Email already taken", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to request email change", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+	}
+}
+
+func (h *handler) ResendVerificationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		err = h.userService.ResendVerification(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrAlreadyVerified) {
+				http.Error(w, "Email already verified", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to resend verification email", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+	}
+}
+
+func (h *handler) VerifyEmailHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err := h.userService.VerifyEmail(r.Context(), req.Token)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidVerifyToken) {
+				http.Error(w, "Invalid or already used token", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrVerifyTokenExpired) {
+				http.Error(w, "Token expired", http.StatusGone)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserAlreadyExists) {
+				http.Error(w, "Email already taken", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to verify email", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultReferralDepth = 3
+	maxReferralDepth     = 10
+)
+
+func (h *handler) ReferralsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		depth := defaultReferralDepth
+		if depthParam := r.URL.Query().Get("depth"); depthParam != "" {
+			d, err := strconv.Atoi(depthParam)
+			if err != nil || d <= 0 || d > maxReferralDepth {
+				http.Error(w, "depth must be between 1 and "+strconv.Itoa(maxReferralDepth), http.StatusBadRequest)
+				return
+			}
+			depth = d
+		}
+
+		tree, err := h.userService.GetReferrals(r.Context(), userID, depth)
+		if err != nil {
+			h.logger.Error("Failed to get referrals", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(tree)
+		if err != nil {
+			h.logger.Error("Failed to encode referrals response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+func (h *handler) ReferralStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		days := defaultStatsDays
+		if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+			d, err := strconv.Atoi(daysParam)
+			if err != nil || d <= 0 || d > maxStatsDays {
+				http.Error(w, "days must be between 1 and "+strconv.Itoa(maxStatsDays), http.StatusBadRequest)
+				return
+			}
+			days = d
+		}
+
+		stats, err := h.userService.GetReferralStats(r.Context(), userID, days)
+		if err != nil {
+			h.logger.Error("Failed to get referral stats", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(stats)
+		if err != nil {
+			h.logger.Error("Failed to encode referral stats response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
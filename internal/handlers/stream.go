@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/middleware/jwt"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+)
+
+const (
+	// streamRefreshInterval bounds how often a stream reloads the
+	// leaderboard, however many balances change in between.
+	streamRefreshInterval = time.Second
+	// streamHeartbeatInterval keeps idle connections from being closed by
+	// proxies.
+	streamHeartbeatInterval = 15 * time.Second
+)
+
+// streamLimiter caps the number of open streams per user.
+type streamLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	streams map[int]int
+}
+
+func newStreamLimiter(limit int) *streamLimiter {
+	return &streamLimiter{limit: limit, streams: make(map[int]int)}
+}
+
+// acquire reserves a stream for the user. A limit of zero or less disables
+// the cap.
+func (l *streamLimiter) acquire(userID int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit > 0 && l.streams[userID] >= l.limit {
+		return false
+	}
+	l.streams[userID]++
+	return true
+}
+
+func (l *streamLimiter) release(userID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.streams[userID] <= 1 {
+		delete(l.streams, userID)
+		return
+	}
+	l.streams[userID]--
+}
+
+// snapshot is one loaded leaderboard view, kept as the JSON sent to clients.
+type snapshot struct {
+	mu       sync.Mutex
+	streams  int
+	data     []byte
+	loadedAt time.Time
+}
+
+// snapshotCache shares leaderboard reloads between streams, so that open
+// streams cost one reload per view and refresh interval instead of one each.
+type snapshotCache struct {
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+}
+
+func newSnapshotCache() *snapshotCache {
+	return &snapshotCache{snapshots: make(map[string]*snapshot)}
+}
+
+// hold keeps the snapshot under key while a stream uses it.
+func (c *snapshotCache) hold(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.snapshots[key]
+	if !ok {
+		s = &snapshot{}
+		c.snapshots[key] = s
+	}
+	s.streams++
+}
+
+// release drops the snapshot under key once no stream holds it.
+func (c *snapshotCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s := c.snapshots[key]; s.streams <= 1 {
+		delete(c.snapshots, key)
+	} else {
+		s.streams--
+	}
+}
+
+// get returns the snapshot under key if it was loaded after since, and loads
+// it otherwise. Streams asking while a load is running wait for it instead of
+// starting their own. The key must be held.
+func (c *snapshotCache) get(key string, since time.Time, load func() (any, error)) ([]byte, error) {
+	c.mu.Lock()
+	s := c.snapshots[key]
+	c.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data != nil && !s.loadedAt.Before(since) {
+		return s.data, nil
+	}
+
+	loadedAt := time.Now()
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s.data, s.loadedAt = data, loadedAt
+	return data, nil
+}
+
+// LeaderboardStreamHandler pushes the top of the leaderboard and the caller's
+// own rank over Server-Sent Events whenever either of them changes. The
+// stream ends when the access token expires or is revoked.
+func (h *handler) LeaderboardStreamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := jwt.ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		period := parsePeriod(r)
+		if !period.Valid() {
+			http.Error(w, "Invalid period", http.StatusBadRequest)
+			return
+		}
+		limit := defaultLeaderboardLimit
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			l, err := strconv.Atoi(limitParam)
+			if err != nil || l <= 0 || l > maxLeaderboardLimit {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxLeaderboardLimit), http.StatusBadRequest)
+				return
+			}
+			limit = l
+		}
+
+		if !h.streams.acquire(userID) {
+			h.logger.Warn("Too many leaderboard streams", slog.Int("user_id", userID))
+			http.Error(w, "Too many open streams", http.StatusTooManyRequests)
+			return
+		}
+		defer h.streams.release(userID)
+
+		// Streams outlive the server's write timeout.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			h.logger.Warn("Failed to clear write deadline", slog.String("error", err.Error()))
+		}
+
+		sub := h.bus.Subscribe(1)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		stream := leaderboardStream{
+			h:       h,
+			rc:      rc,
+			w:       w,
+			userID:  userID,
+			query:   models.LeaderboardQuery{Period: period, Limit: limit},
+			topKey:  fmt.Sprintf("top:%s:%d", period, limit),
+			rankKey: fmt.Sprintf("rank:%s:%d", period, userID),
+		}
+		h.snapshots.hold(stream.topKey)
+		defer h.snapshots.release(stream.topKey)
+		h.snapshots.hold(stream.rankKey)
+		defer h.snapshots.release(stream.rankKey)
+
+		if err := stream.refresh(r, time.Now()); err != nil {
+			return
+		}
+
+		var expired <-chan time.Time
+		if claims.ExpiresAt != nil {
+			expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+			defer expiry.Stop()
+			expired = expiry.C
+		}
+		refresh := time.NewTicker(streamRefreshInterval)
+		defer refresh.Stop()
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		// Events only mark the stream as stale; the refresh ticker reloads
+		// it, so a burst of completions costs one reload. Any snapshot
+		// loaded after the first of them is recent enough.
+		var staleSince time.Time
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-expired:
+				return
+			case <-sub.Events():
+				if staleSince.IsZero() {
+					staleSince = time.Now()
+				}
+			case <-refresh.C:
+				if h.streamRevoked(r, claims) {
+					return
+				}
+				if staleSince.IsZero() {
+					continue
+				}
+				since := staleSince
+				staleSince = time.Time{}
+				if err := stream.refresh(r, since); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if err := stream.write([]byte(": ping\n\n")); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// streamRevoked reports whether the token a stream was opened with has been
+// revoked since. A failed check ends the stream as well; the client
+// reconnects through AuthMiddleware.
+func (h *handler) streamRevoked(r *http.Request, claims *models.UserClaims) bool {
+	revoked, err := h.sessionService.IsRevoked(r.Context(), claims)
+	if err != nil && !errors.Is(err, serviceerrors.ErrUserNotFound) {
+		h.logger.Error("Failed to check token revocation", slog.String("error", err.Error()))
+	}
+	return revoked || err != nil
+}
+
+// leaderboardStream remembers what was last sent so that only changes go out.
+type leaderboardStream struct {
+	h        *handler
+	rc       *http.ResponseController
+	w        http.ResponseWriter
+	userID   int
+	query    models.LeaderboardQuery
+	topKey   string
+	rankKey  string
+	lastTop  []byte
+	lastRank []byte
+}
+
+// refresh sends the top and the user's rank if they changed, from snapshots
+// loaded after since. Only write errors end the stream; failed reloads are
+// retried on the next change.
+func (s *leaderboardStream) refresh(r *http.Request, since time.Time) error {
+	top, err := s.h.snapshots.get(s.topKey, since, func() (any, error) {
+		return s.h.userService.GetLeaderboard(r.Context(), s.query)
+	})
+	if err != nil {
+		s.h.logger.Error("Failed to get leaderboard", slog.String("error", err.Error()))
+	} else if err := s.send("top", top, &s.lastTop); err != nil {
+		return err
+	}
+
+	rank, err := s.h.snapshots.get(s.rankKey, since, func() (any, error) {
+		return s.h.userService.GetRank(r.Context(), s.userID, s.query.Period)
+	})
+	if err != nil {
+		s.h.logger.Error("Failed to get rank", slog.String("error", err.Error()))
+		return nil
+	}
+	return s.send("rank", rank, &s.lastRank)
+}
+
+func (s *leaderboardStream) send(event string, data []byte, last *[]byte) error {
+	if bytes.Equal(data, *last) {
+		return nil
+	}
+	*last = data
+
+	return s.write([]byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data)))
+}
+
+func (s *leaderboardStream) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotCacheSharesLoads(t *testing.T) {
+	c := newSnapshotCache()
+	c.hold("top")
+	defer c.release("top")
+
+	loads := 0
+	load := func() (any, error) {
+		loads++
+		return loads, nil
+	}
+
+	since := time.Now()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.get("top", since, load); err != nil {
+				t.Errorf("get() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("loads for one change = %d, want 1", loads)
+	}
+
+	// A change after the snapshot was loaded needs a new one.
+	data, _ := c.get("top", time.Now(), load)
+	if loads != 2 || string(data) != "2" {
+		t.Fatalf("after a change: loads = %d, data = %s, want 2, 2", loads, data)
+	}
+
+	// A failed load is not cached, so the next get loads again.
+	failed := func() (any, error) { return nil, errors.New("fail") }
+	if _, err := c.get("top", time.Now(), failed); err == nil {
+		t.Fatal("get() error = nil, want the load error")
+	}
+	if data, _ := c.get("top", time.Now(), load); loads != 3 || string(data) != "3" {
+		t.Fatalf("after a failed load: loads = %d, data = %s, want 3, 3", loads, data)
+	}
+}
+
+func TestSnapshotCacheReleasesUnheldKeys(t *testing.T) {
+	c := newSnapshotCache()
+	c.hold("rank:all:1")
+	c.hold("rank:all:1")
+
+	c.release("rank:all:1")
+	if _, ok := c.snapshots["rank:all:1"]; !ok {
+		t.Fatal("snapshot dropped while still held")
+	}
+	c.release("rank:all:1")
+	if _, ok := c.snapshots["rank:all:1"]; ok {
+		t.Fatal("snapshot kept after the last release")
+	}
+}
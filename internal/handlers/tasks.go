@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/go-chi/chi/v5"
+)
+
+// parseTaskFilter reads the catalog query parameters: q, min_reward,
+// max_reward, sort, limit and offset.
+func parseTaskFilter(r *http.Request) (models.TaskFilter, error) {
+	query := r.URL.Query()
+	filter := models.TaskFilter{
+		Search: query.Get("q"),
+		Sort:   query.Get("sort"),
+		Limit:  20,
+	}
+
+	if limitParam := query.Get("limit"); limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l <= 0 || l > 100 {
+			return filter, errors.New("limit must be between 1 and 100")
+		}
+		filter.Limit = l
+	}
+	if offsetParam := query.Get("offset"); offsetParam != "" {
+		o, err := strconv.Atoi(offsetParam)
+		if err != nil || o < 0 {
+			return filter, errors.New("offset must not be negative")
+		}
+		filter.Offset = o
+	}
+	if minParam := query.Get("min_reward"); minParam != "" {
+		m, err := strconv.Atoi(minParam)
+		if err != nil {
+			return filter, errors.New("invalid min_reward")
+		}
+		filter.MinReward = &m
+	}
+	if maxParam := query.Get("max_reward"); maxParam != "" {
+		m, err := strconv.Atoi(maxParam)
+		if err != nil {
+			return filter, errors.New("invalid max_reward")
+		}
+		filter.MaxReward = &m
+	}
+
+	return filter, nil
+}
+
+func (h *handler) ListTasksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := h.taskService.ListTasks(r.Context(), filter)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "Invalid sort", http.StatusBadRequest)
+				return
+			}
+			h.logger.Error("Failed to list tasks", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			h.logger.Error("Failed to encode tasks response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) UserTasksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDStr := chi.URLParam(r, "id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := parseTaskFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := h.taskService.ListUserTasks(r.Context(), userID, filter)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidFilter) {
+				http.Error(w, "Invalid sort", http.StatusBadRequest)
+				return
+			}
+			h.logger.Error("Failed to list user tasks", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			h.logger.Error("Failed to encode user tasks response", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *handler) CreateTaskHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.TaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		task, err := h.taskService.CreateTask(r.Context(), req)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidTask) {
+				http.Error(w, "Invalid task: check name, reward and recurrence settings", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrTaskExists) {
+				http.Error(w, "Task with this name already exists", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUnknownPrereq) {
+				http.Error(w, "Prerequisite task not found", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrPrerequisiteCycle) {
+				http.Error(w, "Prerequisites must not form a cycle", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to create task", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+func (h *handler) UpdateTaskHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		taskIDStr := chi.URLParam(r, "taskID")
+		taskID, err := strconv.Atoi(taskIDStr)
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.TaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		task, err := h.taskService.UpdateTask(r.Context(), taskID, req)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidTask) {
+				http.Error(w, "Invalid task: check name, reward and recurrence settings", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrTaskNotFound) {
+				http.Error(w, "Task not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrTaskExists) {
+				http.Error(w, "Task with this name already exists", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUnknownPrereq) {
+				http.Error(w, "Prerequisite task not found", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrPrerequisiteCycle) {
+				http.Error(w, "Prerequisites must not form a cycle", http.StatusConflict)
+				return
+			}
+			h.logger.Error("Failed to update task", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+func (h *handler) DeleteTaskHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		taskIDStr := chi.URLParam(r, "taskID")
+		taskID, err := strconv.Atoi(taskIDStr)
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		err = h.taskService.DeleteTask(r.Context(), taskID)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrTaskNotFound) {
+				http.Error(w, "Task not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to delete task", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Task archived successfully"})
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWebhookBody bounds the size of a partner callback. The body has to be
+// read in full before it can be verified.
+const maxWebhookBody = 64 << 10
+
+func (h *handler) WebhookTaskHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		provider := chi.URLParam(r, "provider")
+		body, ok := h.readWebhook(w, r, provider)
+		if !ok {
+			return
+		}
+
+		var req models.WebhookTaskRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err := h.webhookService.ConfirmTask(r.Context(), provider, req)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrEventProcessed) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Event already processed"})
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrInvalidEvent) {
+				http.Error(w, "event_id, user_ref and task_id are required", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "Unknown user reference", http.StatusNotFound)
+				return
+			}
+			h.writeCompletionError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Task completed successfully"})
+	}
+}
+
+func (h *handler) WebhookAccountHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		provider := chi.URLParam(r, "provider")
+		body, ok := h.readWebhook(w, r, provider)
+		if !ok {
+			return
+		}
+
+		var req models.WebhookAccountRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err := h.webhookService.LinkAccount(r.Context(), provider, req)
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrInvalidAccount) {
+				http.Error(w, "Invalid external_id", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrInvalidLinkToken) {
+				http.Error(w, "Invalid link_token", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrLinkTokenExpired) {
+				http.Error(w, "Link token expired", http.StatusGone)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrAccountLinked) {
+				http.Error(w, "Account already linked", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, serviceerrors.ErrUserNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to link account", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Account linked successfully"})
+	}
+}
+
+// readWebhook reads a partner callback and checks its signature. It writes
+// the error response itself and returns false when the request is rejected.
+func (h *handler) readWebhook(w http.ResponseWriter, r *http.Request, provider string) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	err = h.webhookService.VerifySignature(provider, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), body)
+	if err != nil {
+		if errors.Is(err, serviceerrors.ErrUnknownProvider) {
+			http.Error(w, "Unknown provider", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
+
+func (h *handler) LinkTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.logger.Info("Invalid method")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		token, err := h.webhookService.IssueLinkToken(r.Context(), userID, chi.URLParam(r, "provider"))
+		if err != nil {
+			if errors.Is(err, serviceerrors.ErrUnknownProvider) {
+				http.Error(w, "Unknown provider", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("Failed to issue link token", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(token); err != nil {
+			h.logger.Error("Failed to encode response", slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package leaderboard
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/dorik33/DeNet/internal/models"
+)
+
+const (
+	maxLevel = 32
+	// levelFactor is the inverse of the chance that a node is promoted to
+	// the next level.
+	levelFactor = 4
+)
+
+// node is a skip list element. span[i] is the number of elements next[i]
+// moves forward by, which is what makes ranks and offsets O(log n).
+type node struct {
+	position models.LeaderboardCursor
+	next     []*node
+	span     []int
+}
+
+// ranksAbove reports whether a comes before b on the leaderboard.
+func ranksAbove(a, b models.LeaderboardCursor) bool {
+	if a.Points != b.Points {
+		return a.Points > b.Points
+	}
+	return a.ID < b.ID
+}
+
+// skipList is an indexable skip list of leaderboard positions. It is not
+// safe for concurrent use.
+type skipList struct {
+	head   *node
+	level  int
+	length int
+	points map[int]int
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:   &node{next: make([]*node, maxLevel), span: make([]int, maxLevel)},
+		level:  1,
+		points: make(map[int]int),
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < maxLevel && rand.IntN(levelFactor) == 0 {
+		level++
+	}
+	return level
+}
+
+func (l *skipList) insert(position models.LeaderboardCursor) {
+	var (
+		update [maxLevel]*node
+		rank   [maxLevel]int
+	)
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i] != nil && ranksAbove(x.next[i].position, position) {
+			rank[i] += x.span[i]
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			update[i].span[i] = l.length
+		}
+		l.level = level
+	}
+
+	n := &node{position: position, next: make([]*node, level), span: make([]int, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+		n.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].span[i]++
+	}
+
+	l.length++
+	l.points[position.ID] = position.Points
+}
+
+func (l *skipList) remove(position models.LeaderboardCursor) {
+	var update [maxLevel]*node
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && ranksAbove(x.next[i].position, position) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	x = x.next[0]
+	if x == nil || x.position != position {
+		return
+	}
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i] == x {
+			update[i].span[i] += x.span[i] - 1
+			update[i].next[i] = x.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+
+	l.length--
+	delete(l.points, position.ID)
+}
+
+// seek returns the number of positions ranked above position and the last
+// node among them, which is the head if there are none.
+func (l *skipList) seek(position models.LeaderboardCursor) (int, *node) {
+	ahead := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && ranksAbove(x.next[i].position, position) {
+			ahead += x.span[i]
+			x = x.next[i]
+		}
+	}
+	return ahead, x
+}
+
+// at returns the node at the zero based offset, or nil past the end.
+func (l *skipList) at(offset int) *node {
+	if offset < 0 || offset >= l.length {
+		return nil
+	}
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && traversed+x.span[i] <= offset+1 {
+			traversed += x.span[i]
+			x = x.next[i]
+		}
+		if traversed == offset+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+func collect(from *node, limit int) []models.LeaderboardCursor {
+	positions := make([]models.LeaderboardCursor, 0, limit)
+	for x := from; x != nil && len(positions) < limit; x = x.next[0] {
+		positions = append(positions, x.position)
+	}
+	return positions
+}
+
+type memoryStore struct {
+	mu   sync.RWMutex
+	list *skipList
+}
+
+// NewMemoryStore returns a Store that keeps the leaderboard in a skip list
+// in process memory.
+func NewMemoryStore() Store {
+	return &memoryStore{list: newSkipList()}
+}
+
+func (s *memoryStore) Add(ctx context.Context, userID int, delta int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points, ok := s.list.points[userID]
+	if !ok {
+		return nil
+	}
+	s.list.remove(models.LeaderboardCursor{Points: points, ID: userID})
+	s.list.insert(models.LeaderboardCursor{Points: points + delta, ID: userID})
+	return nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, position models.LeaderboardCursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if points, ok := s.list.points[position.ID]; ok {
+		s.list.remove(models.LeaderboardCursor{Points: points, ID: position.ID})
+	}
+	s.list.insert(position)
+	return nil
+}
+
+func (s *memoryStore) Remove(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if points, ok := s.list.points[userID]; ok {
+		s.list.remove(models.LeaderboardCursor{Points: points, ID: userID})
+	}
+	return nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, positions []models.LeaderboardCursor) error {
+	list := newSkipList()
+	for _, position := range positions {
+		if points, ok := list.points[position.ID]; ok {
+			list.remove(models.LeaderboardCursor{Points: points, ID: position.ID})
+		}
+		list.insert(position)
+	}
+
+	s.mu.Lock()
+	s.list = list
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Range(ctx context.Context, offset int, limit int) ([]models.LeaderboardCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return collect(s.list.at(offset), limit), nil
+}
+
+func (s *memoryStore) After(ctx context.Context, cursor models.LeaderboardCursor, limit int) ([]models.LeaderboardCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, x := s.list.seek(cursor)
+	x = x.next[0]
+	if x != nil && x.position == cursor {
+		x = x.next[0]
+	}
+	return collect(x, limit), nil
+}
+
+func (s *memoryStore) Before(ctx context.Context, cursor models.LeaderboardCursor, limit int) ([]models.LeaderboardCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahead, _ := s.list.seek(cursor)
+	offset := max(ahead-limit, 0)
+	return collect(s.list.at(offset), ahead-offset), nil
+}
+
+func (s *memoryStore) CountAhead(ctx context.Context, cursor models.LeaderboardCursor) (int, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ahead, _ := s.list.seek(cursor)
+	return ahead, s.list.length, nil
+}
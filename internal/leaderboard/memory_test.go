@@ -0,0 +1,265 @@
+package leaderboard
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/dorik33/DeNet/internal/models"
+)
+
+// reference is the obvious implementation the skip list is checked
+// against: every position in a slice, sorted on demand.
+type reference map[int]int
+
+func (ref reference) sorted() []models.LeaderboardCursor {
+	positions := make([]models.LeaderboardCursor, 0, len(ref))
+	for id, points := range ref {
+		positions = append(positions, models.LeaderboardCursor{Points: points, ID: id})
+	}
+	slices.SortFunc(positions, func(a, b models.LeaderboardCursor) int {
+		switch {
+		case ranksAbove(a, b):
+			return -1
+		case ranksAbove(b, a):
+			return 1
+		}
+		return 0
+	})
+	return positions
+}
+
+// ahead returns the number of positions ranked above cursor.
+func (ref reference) ahead(cursor models.LeaderboardCursor) int {
+	n := 0
+	for id, points := range ref {
+		if ranksAbove(models.LeaderboardCursor{Points: points, ID: id}, cursor) {
+			n++
+		}
+	}
+	return n
+}
+
+func window(positions []models.LeaderboardCursor, from int, limit int) []models.LeaderboardCursor {
+	from = min(max(from, 0), len(positions))
+	return positions[from:min(from+limit, len(positions))]
+}
+
+// checkList verifies the skip list structure: level 0 is sorted and holds
+// every position, and every span is the distance to the node it skips to.
+func checkList(t *testing.T, l *skipList, want []models.LeaderboardCursor) {
+	t.Helper()
+
+	rank := make(map[*node]int, l.length)
+	var got []models.LeaderboardCursor
+	for x, i := l.head.next[0], 1; x != nil; x, i = x.next[0], i+1 {
+		rank[x] = i
+		got = append(got, x.position)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("level 0 = %v, want %v", got, want)
+	}
+	if l.length != len(want) {
+		t.Fatalf("length = %d, want %d", l.length, len(want))
+	}
+
+	for i := 0; i < l.level; i++ {
+		for x := l.head; x.next[i] != nil; x = x.next[i] {
+			if x.span[i] != rank[x.next[i]]-rank[x] {
+				t.Fatalf("level %d: span from rank %d = %d, want %d", i, rank[x], x.span[i], rank[x.next[i]]-rank[x])
+			}
+		}
+	}
+}
+
+// checkStore compares every read of the store with the reference.
+func checkStore(t *testing.T, s *memoryStore, ref reference, rng *rand.Rand) {
+	t.Helper()
+	ctx := context.Background()
+
+	want := ref.sorted()
+	checkList(t, s.list, want)
+
+	for range 20 {
+		offset, limit := rng.IntN(len(want)+3), 1+rng.IntN(10)
+		got, _ := s.Range(ctx, offset, limit)
+		if w := window(want, offset, limit); !slices.Equal(got, w) {
+			t.Fatalf("Range(%d, %d) = %v, want %v", offset, limit, got, w)
+		}
+	}
+
+	// Cursors both on and between stored positions.
+	cursors := []models.LeaderboardCursor{{Points: rng.IntN(100) - 10, ID: rng.IntN(50)}}
+	if len(want) > 0 {
+		cursors = append(cursors, want[rng.IntN(len(want))])
+	}
+	for _, cursor := range cursors {
+		ahead := ref.ahead(cursor)
+		next := ahead
+		if next < len(want) && want[next] == cursor {
+			next++
+		}
+
+		gotAhead, total, _ := s.CountAhead(ctx, cursor)
+		if gotAhead != ahead || total != len(want) {
+			t.Fatalf("CountAhead(%v) = %d, %d, want %d, %d", cursor, gotAhead, total, ahead, len(want))
+		}
+
+		limit := 1 + rng.IntN(10)
+		after, _ := s.After(ctx, cursor, limit)
+		if w := window(want, next, limit); !slices.Equal(after, w) {
+			t.Fatalf("After(%v, %d) = %v, want %v", cursor, limit, after, w)
+		}
+
+		before, _ := s.Before(ctx, cursor, limit)
+		if w := window(want, ahead-limit, min(limit, ahead)); !slices.Equal(before, w) {
+			t.Fatalf("Before(%v, %d) = %v, want %v", cursor, limit, before, w)
+		}
+	}
+}
+
+func TestMemoryStoreMatchesSortedSlice(t *testing.T) {
+	ctx := context.Background()
+
+	for seed := range uint64(20) {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		s := NewMemoryStore().(*memoryStore)
+		ref := reference{}
+
+		for range 300 {
+			// Few ids and points, so that ties and updates of stored users
+			// are common.
+			id, points := rng.IntN(50), rng.IntN(60)
+			switch op := rng.IntN(10); {
+			case op < 4:
+				s.Set(ctx, models.LeaderboardCursor{Points: points, ID: id})
+				ref[id] = points
+			case op < 7:
+				delta := rng.IntN(41) - 20
+				s.Add(ctx, id, delta)
+				if _, ok := ref[id]; ok {
+					ref[id] += delta
+				}
+			case op < 9:
+				s.Remove(ctx, id)
+				delete(ref, id)
+			default:
+				positions := make([]models.LeaderboardCursor, rng.IntN(30))
+				clear(ref)
+				for i := range positions {
+					positions[i] = models.LeaderboardCursor{Points: rng.IntN(60), ID: rng.IntN(50)}
+					ref[positions[i].ID] = positions[i].Points
+				}
+				s.Replace(ctx, positions)
+			}
+			checkStore(t, s, ref, rng)
+		}
+	}
+}
+
+func TestMemoryStoreReads(t *testing.T) {
+	// Ranked: 4 (50), 2 (30), 5 (30), 1 (10), 3 (0).
+	positions := []models.LeaderboardCursor{
+		{Points: 10, ID: 1},
+		{Points: 30, ID: 2},
+		{Points: 0, ID: 3},
+		{Points: 50, ID: 4},
+		{Points: 30, ID: 5},
+	}
+	s := NewMemoryStore()
+	s.Replace(context.Background(), positions)
+
+	top := models.LeaderboardCursor{Points: 50, ID: 4}
+	tie := models.LeaderboardCursor{Points: 30, ID: 5}
+	bottom := models.LeaderboardCursor{Points: 0, ID: 3}
+	between := models.LeaderboardCursor{Points: 20, ID: 9}
+	pos := func(ids ...int) []models.LeaderboardCursor {
+		points := map[int]int{1: 10, 2: 30, 3: 0, 4: 50, 5: 30}
+		var out []models.LeaderboardCursor
+		for _, id := range ids {
+			out = append(out, models.LeaderboardCursor{Points: points[id], ID: id})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		read func() ([]models.LeaderboardCursor, error)
+		want []models.LeaderboardCursor
+	}{
+		{"range from top", func() ([]models.LeaderboardCursor, error) { return s.Range(context.Background(), 0, 2) }, pos(4, 2)},
+		{"range past end", func() ([]models.LeaderboardCursor, error) { return s.Range(context.Background(), 5, 2) }, pos()},
+		{"range cut at end", func() ([]models.LeaderboardCursor, error) { return s.Range(context.Background(), 3, 5) }, pos(1, 3)},
+		{"after tie", func() ([]models.LeaderboardCursor, error) { return s.After(context.Background(), tie, 5) }, pos(1, 3)},
+		{"after bottom", func() ([]models.LeaderboardCursor, error) { return s.After(context.Background(), bottom, 5) }, pos()},
+		{"after gap", func() ([]models.LeaderboardCursor, error) { return s.After(context.Background(), between, 1) }, pos(1)},
+		{"before top", func() ([]models.LeaderboardCursor, error) { return s.Before(context.Background(), top, 3) }, pos()},
+		{"before tie", func() ([]models.LeaderboardCursor, error) { return s.Before(context.Background(), tie, 1) }, pos(2)},
+		{"before bottom", func() ([]models.LeaderboardCursor, error) { return s.Before(context.Background(), bottom, 10) }, pos(4, 2, 5, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read()
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		cursor    models.LeaderboardCursor
+		wantAhead int
+	}{
+		{top, 0},
+		{tie, 2},
+		{between, 3},
+		{bottom, 4},
+	} {
+		ahead, total, _ := s.CountAhead(context.Background(), tt.cursor)
+		if ahead != tt.wantAhead || total != len(positions) {
+			t.Errorf("CountAhead(%v) = %d, %d, want %d, %d", tt.cursor, ahead, total, tt.wantAhead, len(positions))
+		}
+	}
+}
+
+// benchmarkUsers matches the size of the database benchmarks in
+// internal/repository/userrepo.
+const benchmarkUsers = 100_000
+
+func newBenchmarkStore(b *testing.B) Store {
+	b.Helper()
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	positions := make([]models.LeaderboardCursor, benchmarkUsers)
+	for i := range positions {
+		positions[i] = models.LeaderboardCursor{Points: rng.IntN(10_000), ID: i + 1}
+	}
+	s := NewMemoryStore()
+	s.Replace(context.Background(), positions)
+	return s
+}
+
+func BenchmarkMemoryStore_Range(b *testing.B) {
+	s := newBenchmarkStore(b)
+	ctx := context.Background()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Range(ctx, (i*997)%benchmarkUsers, 100)
+	}
+}
+
+func BenchmarkMemoryStore_CountAhead(b *testing.B) {
+	s := newBenchmarkStore(b)
+	ctx := context.Background()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.CountAhead(ctx, models.LeaderboardCursor{Points: i % 10_000, ID: i % benchmarkUsers})
+	}
+}
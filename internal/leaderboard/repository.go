@@ -0,0 +1,207 @@
+package leaderboard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
+)
+
+// CachedUserRepository serves the all-time leaderboard from a Store and
+// passes everything else through to the wrapped repository. Balance changes
+// made by AddPoints reach the store once their transaction commits.
+//
+// Writes racing with a rebuild may be overwritten by the snapshot it loaded,
+// so the store is only eventually consistent: the periodic Rebuild is what
+// bounds the drift.
+type CachedUserRepository struct {
+	repository.UserRepository
+	cache Store
+	ready atomic.Bool
+	log   *slog.Logger
+}
+
+func NewCachedUserRepository(repo repository.UserRepository, cache Store, log *slog.Logger) *CachedUserRepository {
+	return &CachedUserRepository{
+		UserRepository: repo,
+		cache:          cache,
+		log:            log,
+	}
+}
+
+// Rebuild reloads the store from the database. Until the first rebuild
+// succeeds the leaderboard is read from the database.
+func (repo *CachedUserRepository) Rebuild(ctx context.Context) error {
+	positions, err := repo.UserRepository.ListLeaderboardPositions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list leaderboard positions: %w", err)
+	}
+
+	err = repo.cache.Replace(ctx, positions)
+	if err != nil {
+		return fmt.Errorf("failed to replace leaderboard cache: %w", err)
+	}
+
+	repo.ready.Store(true)
+	repo.log.Info("Leaderboard cache successfully rebuilt", slog.Int("users", len(positions)))
+	return nil
+}
+
+func (repo *CachedUserRepository) CreateUser(ctx context.Context, email string, password []byte, referralCode string) (int, error) {
+	id, err := repo.UserRepository.CreateUser(ctx, email, password, referralCode)
+	if err != nil {
+		return 0, err
+	}
+
+	store.AfterCommit(ctx, func() {
+		err := repo.cache.Set(context.WithoutCancel(ctx), models.LeaderboardCursor{Points: 0, ID: id})
+		if err != nil {
+			repo.log.Error("Failed to update leaderboard cache", slog.Int("user_id", id), slog.String("error", err.Error()))
+		}
+	})
+	return id, nil
+}
+
+// UpdateProfile adds or removes the user from the store when they change
+// whether they are shown on the leaderboard.
+func (repo *CachedUserRepository) UpdateProfile(ctx context.Context, user *models.User) error {
+	err := repo.UserRepository.UpdateProfile(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	hidden, position := user.HideFromLeaderboard, models.LeaderboardCursor{Points: user.Points, ID: user.ID}
+	store.AfterCommit(ctx, func() {
+		var err error
+		if hidden {
+			err = repo.cache.Remove(context.WithoutCancel(ctx), position.ID)
+		} else {
+			err = repo.cache.Set(context.WithoutCancel(ctx), position)
+		}
+		if err != nil {
+			repo.log.Error("Failed to update leaderboard cache", slog.Int("user_id", position.ID), slog.String("error", err.Error()))
+		}
+	})
+	return nil
+}
+
+func (repo *CachedUserRepository) AddPoints(ctx context.Context, entry *models.PointTransaction) error {
+	err := repo.UserRepository.AddPoints(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	userID, delta := entry.UserID, entry.Delta
+	store.AfterCommit(ctx, func() {
+		repo.apply(ctx, userID, delta)
+	})
+	return nil
+}
+
+// ReconcilePoints applies the balance correction to the store once the
+// transaction commits, the same way AddPoints does.
+func (repo *CachedUserRepository) ReconcilePoints(ctx context.Context, userID int) (int, error) {
+	delta, err := repo.UserRepository.ReconcilePoints(ctx, userID)
+	if err != nil || delta == 0 {
+		return delta, err
+	}
+
+	store.AfterCommit(ctx, func() {
+		repo.apply(ctx, userID, delta)
+	})
+	return delta, nil
+}
+
+// apply adds delta to the user's cached balance. Deltas commute, so hooks
+// of concurrent transactions may run in any order.
+func (repo *CachedUserRepository) apply(ctx context.Context, userID int, delta int) {
+	err := repo.cache.Add(context.WithoutCancel(ctx), userID, delta)
+	if err != nil {
+		repo.log.Error("Failed to update leaderboard cache", slog.Int("user_id", userID), slog.String("error", err.Error()))
+	}
+}
+
+func (repo *CachedUserRepository) GetLeaderboard(ctx context.Context, since *time.Time, cursor *models.LeaderboardCursor, offset int, limit int) ([]models.User, error) {
+	if since != nil || !repo.ready.Load() {
+		return repo.UserRepository.GetLeaderboard(ctx, since, cursor, offset, limit)
+	}
+
+	var (
+		positions []models.LeaderboardCursor
+		err       error
+	)
+	if cursor != nil {
+		positions, err = repo.cache.After(ctx, *cursor, limit)
+	} else {
+		positions, err = repo.cache.Range(ctx, offset, limit)
+	}
+	if err != nil {
+		repo.log.Warn("Leaderboard cache unavailable", slog.String("error", err.Error()))
+		return repo.UserRepository.GetLeaderboard(ctx, since, cursor, offset, limit)
+	}
+	return repo.users(ctx, positions)
+}
+
+func (repo *CachedUserRepository) GetLeaderboardBefore(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor, limit int) ([]models.User, error) {
+	if since != nil || !repo.ready.Load() {
+		return repo.UserRepository.GetLeaderboardBefore(ctx, since, cursor, limit)
+	}
+
+	positions, err := repo.cache.Before(ctx, cursor, limit)
+	if err != nil {
+		repo.log.Warn("Leaderboard cache unavailable", slog.String("error", err.Error()))
+		return repo.UserRepository.GetLeaderboardBefore(ctx, since, cursor, limit)
+	}
+	return repo.users(ctx, positions)
+}
+
+func (repo *CachedUserRepository) CountRankedAhead(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor) (int, int, error) {
+	if since != nil || !repo.ready.Load() {
+		return repo.UserRepository.CountRankedAhead(ctx, since, cursor)
+	}
+
+	ahead, total, err := repo.cache.CountAhead(ctx, cursor)
+	if err != nil {
+		repo.log.Warn("Leaderboard cache unavailable", slog.String("error", err.Error()))
+		return repo.UserRepository.CountRankedAhead(ctx, since, cursor)
+	}
+	return ahead, total, nil
+}
+
+// users loads the users at the given positions, keeping their order and
+// the cached balance so that the page agrees with the ranks around it.
+func (repo *CachedUserRepository) users(ctx context.Context, positions []models.LeaderboardCursor) ([]models.User, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, len(positions))
+	for i, position := range positions {
+		ids[i] = position.ID
+	}
+
+	found, err := repo.UserRepository.GetLeaderboardUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+
+	users := make([]models.User, 0, len(positions))
+	for _, position := range positions {
+		user, ok := byID[position.ID]
+		if !ok {
+			continue
+		}
+		user.Points = position.Points
+		users = append(users, user)
+	}
+	return users, nil
+}
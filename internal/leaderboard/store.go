@@ -0,0 +1,38 @@
+// Package leaderboard keeps the all-time leaderboard in a sorted structure so
+// that pages and ranks are served without scanning the users table.
+package leaderboard
+
+import (
+	"context"
+
+	"github.com/dorik33/DeNet/internal/models"
+)
+
+// Store holds every user's lifetime balance ordered the way the leaderboard
+// is: points descending, then id ascending. Positions are
+// models.LeaderboardCursor values.
+//
+// The in-process implementation is NewMemoryStore. A shared implementation,
+// such as a Redis sorted set, has to fold the id into the score (or keep
+// equal scores ordered by member) so that ties come out in the same order.
+type Store interface {
+	// Add changes the user's points by delta. Users that are not in the
+	// store, such as those hidden from the leaderboard, are left out.
+	Add(ctx context.Context, userID int, delta int) error
+	// Set puts the user at the given position, adding them if needed.
+	Set(ctx context.Context, position models.LeaderboardCursor) error
+	// Remove takes the user off the leaderboard.
+	Remove(ctx context.Context, userID int) error
+	// Replace swaps the whole content of the store for positions.
+	Replace(ctx context.Context, positions []models.LeaderboardCursor) error
+	// Range returns up to limit positions starting at the zero based offset.
+	Range(ctx context.Context, offset int, limit int) ([]models.LeaderboardCursor, error)
+	// After returns up to limit positions ranked right below the cursor.
+	After(ctx context.Context, cursor models.LeaderboardCursor, limit int) ([]models.LeaderboardCursor, error)
+	// Before returns up to limit positions ranked right above the cursor,
+	// highest ranked first.
+	Before(ctx context.Context, cursor models.LeaderboardCursor, limit int) ([]models.LeaderboardCursor, error)
+	// CountAhead returns the number of positions ranked above the cursor
+	// and the number of positions in the store.
+	CountAhead(ctx context.Context, cursor models.LeaderboardCursor) (int, int, error)
+}
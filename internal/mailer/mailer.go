@@ -0,0 +1,54 @@
+// Package mailer sends transactional email to users.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dorik33/DeNet/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by MAILER.
+func New(cfg *config.Config, log *slog.Logger) (Mailer, error) {
+	switch cfg.EmailCfg.Mailer {
+	case "smtp":
+		return NewSMTPMailer(cfg.EmailCfg.SMTPHost, cfg.EmailCfg.SMTPPort, cfg.EmailCfg.SMTPUsername, cfg.EmailCfg.SMTPPassword, cfg.EmailCfg.From)
+	case "file":
+		return NewFileMailer(cfg.EmailCfg.MailerFile), nil
+	case "log", "":
+		return NewLogMailer(log), nil
+	}
+	return nil, fmt.Errorf("unknown mailer %q", cfg.EmailCfg.Mailer)
+}
+
+type logMailer struct {
+	log *slog.Logger
+}
+
+// NewLogMailer returns a Mailer that writes messages to the log instead of
+// delivering them. It is meant for local development only: messages may
+// carry secrets such as verification links.
+func NewLogMailer(log *slog.Logger) Mailer {
+	return &logMailer{log: log}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	m.log.Info("Email not delivered, logging it instead",
+		slog.String("component", "mailer"),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
@@ -1,17 +1,37 @@
 package jwt
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
-	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/signing"
 	"github.com/dorik33/DeNet/internal/utills"
 	"github.com/go-chi/chi/v5"
 )
 
-func AuthMiddleware(logger *slog.Logger, cfg *config.Config) func(next http.Handler) http.Handler {
+type claimsKey struct{}
+
+// RevocationChecker reports whether a validly signed token was revoked
+// before its expiry.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *models.UserClaims) (bool, error)
+}
+
+// ClaimsFromContext returns the claims of the token accepted by
+// AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) (*models.UserClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*models.UserClaims)
+	return claims, ok
+}
+
+func AuthMiddleware(logger *slog.Logger, keys *signing.KeySet, revocations RevocationChecker) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -29,21 +49,64 @@ func AuthMiddleware(logger *slog.Logger, cfg *config.Config) func(next http.Hand
 			}
 
 			token := parts[1]
-			userID, err := utills.ValidateToken(token, []byte(cfg.SecretKey))
+			claims, err := utills.ValidateToken(token, keys)
 			if err != nil {
 				logger.Warn("Invalid token", slog.String("token", token), slog.String("error", err.Error()))
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
+			revoked, err := revocations.IsRevoked(r.Context(), claims)
+			if err != nil && !errors.Is(err, serviceerrors.ErrUserNotFound) {
+				logger.Error("Failed to check token revocation", slog.String("error", err.Error()))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if revoked || err != nil {
+				logger.Warn("Revoked token", slog.String("jti", claims.ID))
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			userID, _ := claims.UserID()
 			urlUserID := chi.URLParam(r, "id")
 			if urlUserID != "" {
 				if strconv.Itoa(userID) != urlUserID {
-					logger.Warn("Unauthorized access attempt", slog.Int("user_id", userID), slog.String("requested_id", urlUserID))
-					http.Error(w, "You are not authorized to access this resource.", http.StatusForbidden)
-					return
+					if claims.Role != models.RoleAdmin {
+						logger.Warn("Unauthorized access attempt", slog.Int("user_id", userID), slog.String("requested_id", urlUserID))
+						http.Error(w, "You are not authorized to access this resource.", http.StatusForbidden)
+						return
+					}
+					logger.Info("Admin access to another user's resource",
+						slog.String("component", "audit"),
+						slog.Int("admin_id", userID),
+						slog.String("requested_id", urlUserID),
+						slog.String("method", r.Method),
+						slog.String("path", r.URL.Path),
+					)
 				}
 			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+		})
+	}
+}
+
+// RequireRole only lets through requests whose token carries one of the given
+// roles. It must run after AuthMiddleware.
+func RequireRole(logger *slog.Logger, roles ...models.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !slices.Contains(roles, claims.Role) {
+				logger.Warn("Insufficient role", slog.String("user_id", claims.Subject), slog.String("role", string(claims.Role)), slog.String("path", r.URL.Path))
+				http.Error(w, "You are not authorized to access this resource.", http.StatusForbidden)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -1,9 +1,12 @@
 package models
 
+import "time"
+
 type RegisterRequest struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
+	ReferralCode    string `json:"referral_code"`
 }
 
 type LoginRequest struct {
@@ -11,10 +14,88 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SetRoleRequest struct {
+	Role Role `json:"role"`
+}
+
 type SetReferrerRequest struct {
-	ReferrerID int `json:"referrer_id"`
+	ReferralCode string `json:"referral_code"`
+}
+
+type SetReferralCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// UpdateProfileRequest changes only the fields that are present. An empty
+// string clears the field.
+type UpdateProfileRequest struct {
+	DisplayName         *string `json:"display_name"`
+	AvatarURL           *string `json:"avatar_url"`
+	HideFromLeaderboard *bool   `json:"hide_from_leaderboard"`
+	Locale              *string `json:"locale"`
+	Timezone            *string `json:"timezone"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type TaskRequest struct {
+	Name           string       `json:"name"`
+	Description    string       `json:"description"`
+	Reward         int          `json:"reward"`
+	Recurrence     Recurrence   `json:"recurrence"`
+	IntervalHours  *int         `json:"interval_hours"`
+	MaxCompletions *int         `json:"max_completions"`
+	MinPoints      int          `json:"min_points"`
+	Prerequisites  []int        `json:"prerequisites"`
+	Verification   Verification `json:"verification"`
+	Provider       *string      `json:"provider"`
+
+	StartsAt          *time.Time `json:"starts_at"`
+	EndsAt            *time.Time `json:"ends_at"`
+	CompletionCap     *int       `json:"completion_cap"`
+	RewardDecayPerDay int        `json:"reward_decay_per_day"`
+	MinReward         int        `json:"min_reward"`
 }
 
 type CompleteTaskRequest struct {
-	TaskID int `json:"task_id"`
+	TaskID int        `json:"task_id"`
+	Proof  *TaskProof `json:"proof"`
+}
+
+type WebhookTaskRequest struct {
+	EventID string `json:"event_id"`
+	UserRef string `json:"user_ref"`
+	TaskID  int    `json:"task_id"`
+}
+
+// WebhookAccountRequest is sent by a partner once the user has handed it a
+// link token, binding the partner's account to the user the token names.
+type WebhookAccountRequest struct {
+	LinkToken  string `json:"link_token"`
+	ExternalID string `json:"external_id"`
+}
+
+type ReviewRequest struct {
+	Comment string `json:"comment"`
 }
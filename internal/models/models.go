@@ -1,43 +1,502 @@
 package models
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID           int       `json:"id"`
 	Email        string    `json:"email"`
 	HashPassword []byte    `json:"-"`
 	ReferrerID   *int      `json:"referrer_id,omitempty"`
+	ReferralCode string    `json:"referral_code,omitempty"`
 	Points       int       `json:"points"`
+	Role         Role      `json:"role,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	DisplayName         *string `json:"display_name,omitempty"`
+	AvatarURL           *string `json:"avatar_url,omitempty"`
+	HideFromLeaderboard bool    `json:"hide_from_leaderboard"`
+	Locale              *string `json:"locale,omitempty"`
+	Timezone            *string `json:"timezone,omitempty"`
+	EmailVerified       bool    `json:"email_verified"`
+}
+
+// PublicName is how the user is shown to other users: the display name, or
+// a masked email for users who have not picked one.
+func (u User) PublicName() string {
+	if u.DisplayName != nil {
+		return *u.DisplayName
+	}
+	local, _, _ := strings.Cut(u.Email, "@")
+	for _, r := range local {
+		return string(r) + "***"
+	}
+	return "***"
+}
+
+// Profile is the user's own view of their profile settings.
+type Profile struct {
+	ID                  int     `json:"id"`
+	Email               string  `json:"email"`
+	EmailVerified       bool    `json:"email_verified"`
+	DisplayName         *string `json:"display_name"`
+	AvatarURL           *string `json:"avatar_url"`
+	HideFromLeaderboard bool    `json:"hide_from_leaderboard"`
+	Locale              *string `json:"locale"`
+	Timezone            *string `json:"timezone"`
+}
+
+// Recurrence says how often a task may be completed again.
+type Recurrence string
+
+const (
+	RecurrenceOnce     Recurrence = "once"
+	RecurrenceDaily    Recurrence = "daily"
+	RecurrenceWeekly   Recurrence = "weekly"
+	RecurrenceInterval Recurrence = "interval"
+)
+
+func (r Recurrence) Valid() bool {
+	switch r {
+	case RecurrenceOnce, RecurrenceDaily, RecurrenceWeekly, RecurrenceInterval:
+		return true
+	}
+	return false
+}
+
+// Verification says who confirms a task completion.
+type Verification string
+
+const (
+	VerificationAuto   Verification = "auto"
+	VerificationManual Verification = "manual"
+	VerificationProof  Verification = "proof"
+	// VerificationWebhook tasks are confirmed by the partner named in
+	// Task.Provider and cannot be completed by the user directly.
+	VerificationWebhook Verification = "webhook"
+)
+
+func (v Verification) Valid() bool {
+	switch v {
+	case VerificationAuto, VerificationManual, VerificationProof, VerificationWebhook:
+		return true
+	}
+	return false
 }
 
 type Task struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Reward      int       `json:"reward"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID             int          `json:"id"`
+	Name           string       `json:"name"`
+	Description    string       `json:"description"`
+	Reward         int          `json:"reward"`
+	Recurrence     Recurrence   `json:"recurrence"`
+	IntervalHours  *int         `json:"interval_hours,omitempty"`
+	MaxCompletions *int         `json:"max_completions,omitempty"`
+	MinPoints      int          `json:"min_points"`
+	Prerequisites  []int        `json:"prerequisites"`
+	Verification   Verification `json:"verification"`
+	Provider       *string      `json:"provider,omitempty"`
+
+	StartsAt          *time.Time `json:"starts_at,omitempty"`
+	EndsAt            *time.Time `json:"ends_at,omitempty"`
+	CompletionCap     *int       `json:"completion_cap,omitempty"`
+	CompletionCount   int        `json:"completion_count"`
+	RewardDecayPerDay int        `json:"reward_decay_per_day,omitempty"`
+	MinReward         int        `json:"min_reward,omitempty"`
+	CurrentReward     int        `json:"current_reward,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// RewardAt returns the reward for completing the task at the given time. The
+// reward drops by RewardDecayPerDay for every full day since the task started
+// but never below MinReward.
+func (t *Task) RewardAt(now time.Time) int {
+	if t.RewardDecayPerDay == 0 {
+		return t.Reward
+	}
+
+	start := t.CreatedAt
+	if t.StartsAt != nil {
+		start = *t.StartsAt
+	}
+	days := int(now.Sub(start).Hours() / 24)
+	if days <= 0 {
+		return t.Reward
+	}
+
+	return max(t.Reward-days*t.RewardDecayPerDay, t.MinReward)
+}
+
+// NextCompletionAt returns when the user may complete the task again given
+// how many times and when they last completed it. ok is false once the task
+// can never be completed again. Daily and weekly periods follow UTC calendar
+// days and ISO weeks.
+func (t *Task) NextCompletionAt(completions int, last *time.Time) (next time.Time, ok bool) {
+	if t.MaxCompletions != nil && completions >= *t.MaxCompletions {
+		return time.Time{}, false
+	}
+	if last == nil {
+		return time.Time{}, true
+	}
+
+	utc := last.UTC()
+	day := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+	switch t.Recurrence {
+	case RecurrenceDaily:
+		return day.AddDate(0, 0, 1), true
+	case RecurrenceWeekly:
+		sinceMonday := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, 7-sinceMonday), true
+	case RecurrenceInterval:
+		if t.IntervalHours != nil {
+			return last.Add(time.Duration(*t.IntervalHours) * time.Hour), true
+		}
+	}
+	return time.Time{}, false
+}
+
+type TaskState string
+
+const (
+	TaskStateAvailable TaskState = "available"
+	TaskStateCompleted TaskState = "completed"
+	TaskStateLocked    TaskState = "locked"
+	TaskStatePending   TaskState = "pending"
+)
+
+// TaskProgress is a catalog task as seen by one user.
+type TaskProgress struct {
+	Task
+	State       TaskState  `json:"state"`
+	Completions int        `json:"completions"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	AvailableAt *time.Time `json:"available_at,omitempty"`
+	Locked      bool       `json:"-"`
+	Pending     bool       `json:"-"`
+}
+
+// TaskFilter narrows and orders the task catalog. Sort is one of the keys of
+// the repository's sort whitelist, e.g. "reward" or "-reward".
+type TaskFilter struct {
+	Search    string
+	MinReward *int
+	MaxReward *int
+	Sort      string
+	Limit     int
+	Offset    int
+}
+
+type TasksPage struct {
+	Tasks  []Task `json:"tasks"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type TaskProgressPage struct {
+	Tasks  []TaskProgress `json:"tasks"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+type SubmissionStatus string
+
+const (
+	SubmissionPending  SubmissionStatus = "pending"
+	SubmissionApproved SubmissionStatus = "approved"
+	SubmissionRejected SubmissionStatus = "rejected"
+)
+
+type ProofType string
+
+const (
+	ProofText ProofType = "text"
+	ProofURL  ProofType = "url"
+	ProofFile ProofType = "file"
+)
+
+// TaskProof is what a user attaches to a completion for review. File proofs
+// carry a reference to an already uploaded file, not its contents.
+type TaskProof struct {
+	Type  ProofType `json:"type"`
+	Value string    `json:"value"`
+}
+
+// Submission is a single completion of a task by a user, stored in
+// user_tasks. Auto-verified tasks are approved right away.
+type Submission struct {
+	ID            int64            `json:"id"`
+	UserID        int              `json:"user_id"`
+	TaskID        int              `json:"task_id"`
+	TaskName      string           `json:"task_name,omitempty"`
+	Status        SubmissionStatus `json:"status"`
+	Proof         *TaskProof       `json:"proof,omitempty"`
+	CompletedAt   time.Time        `json:"completed_at"`
+	ReviewedBy    *int             `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time       `json:"reviewed_at,omitempty"`
+	ReviewComment *string          `json:"review_comment,omitempty"`
 }
 
-type UserTask struct {
-	UserID      int       `json:"user_id"`
-	TaskID      int       `json:"task_id"`
-	CompletedAt time.Time `json:"completed_at"`
+// LinkToken is handed by the user to a partner to prove which account the
+// partner should link.
+type LinkToken struct {
+	LinkToken string    `json:"link_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WebhookEvent is a completion confirmed by a partner. EventID is unique per
+// provider, which makes redelivered callbacks idempotent.
+type WebhookEvent struct {
+	Provider   string    `json:"provider"`
+	EventID    string    `json:"event_id"`
+	UserID     int       `json:"user_id"`
+	TaskID     int       `json:"task_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type SubmissionsPage struct {
+	Submissions []Submission `json:"submissions"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
 }
 
 type UserStatus struct {
-	ID         int    `json:"id"`
-	Email      string `json:"email"`
-	Points     int    `json:"points"`
-	ReferrerID *int   `json:"referrer_id,omitempty"`
-	Tasks      []Task `json:"tasks"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Points        int    `json:"points"`
+	ReferrerID    *int   `json:"referrer_id,omitempty"`
+	ReferralCode  string `json:"referral_code"`
+	Tasks         []Task `json:"tasks"`
+}
+
+type PointTransaction struct {
+	ID           int64     `json:"id"`
+	UserID       int       `json:"user_id"`
+	Delta        int       `json:"delta"`
+	Reason       string    `json:"reason"`
+	TaskID       *int      `json:"task_id,omitempty"`
+	SourceUserID *int      `json:"source_user_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Reasons recorded in the points ledger.
+const (
+	ReasonOpeningBalance     = "opening_balance"
+	ReasonTaskCompleted      = "task_completed"
+	ReasonReferralSignup     = "referral_signup"
+	ReasonReferralCommission = "referral_commission"
+)
+
+// ReferralNode is a user in someone's downline. Commission is what the
+// downline owner earned from this user's task rewards.
+type ReferralNode struct {
+	UserID     int             `json:"user_id"`
+	ReferrerID int             `json:"-"`
+	Level      int             `json:"level"`
+	ReferredAt *time.Time      `json:"referred_at,omitempty"`
+	Commission int             `json:"commission"`
+	Referrals  []*ReferralNode `json:"referrals"`
+}
+
+type ReferralTree struct {
+	UserID          int             `json:"user_id"`
+	Depth           int             `json:"depth"`
+	Count           int             `json:"count"`
+	TotalCommission int             `json:"total_commission"`
+	Referrals       []*ReferralNode `json:"referrals"`
+}
+
+// LeaderboardCursor is the position of a user on the leaderboard, which is
+// ordered by points descending and then by id, so that ties always come out
+// in the same order.
+type LeaderboardCursor struct {
+	Points int
+	ID     int
+}
+
+func (c LeaderboardCursor) String() string {
+	return strconv.Itoa(c.Points) + ":" + strconv.Itoa(c.ID)
+}
+
+func ParseLeaderboardCursor(s string) (LeaderboardCursor, error) {
+	points, id, ok := strings.Cut(s, ":")
+	if !ok {
+		return LeaderboardCursor{}, errors.New("invalid leaderboard cursor")
+	}
+	var (
+		c   LeaderboardCursor
+		err error
+	)
+	if c.Points, err = strconv.Atoi(points); err != nil {
+		return LeaderboardCursor{}, errors.New("invalid leaderboard cursor")
+	}
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return LeaderboardCursor{}, errors.New("invalid leaderboard cursor")
+	}
+	return c, nil
+}
+
+// Period is the window a leaderboard ranks points earned in. Windows are
+// calendar based in UTC: today, the week since Monday, the month since the
+// 1st, or the whole lifetime balance.
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+	PeriodAll   Period = "all"
+)
+
+func (p Period) Valid() bool {
+	switch p {
+	case PeriodDay, PeriodWeek, PeriodMonth, PeriodAll:
+		return true
+	}
+	return false
+}
+
+// Start returns the beginning of the window containing now, or nil for the
+// lifetime leaderboard.
+func (p Period) Start(now time.Time) *time.Time {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var start time.Time
+	switch p {
+	case PeriodDay:
+		start = today
+	case PeriodWeek:
+		start = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case PeriodMonth:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+	return &start
+}
+
+// LeaderboardEntry is a user as shown on the public leaderboard. It carries
+// no email or referrer, only what the user chose to make public.
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	UserID      int     `json:"user_id"`
+	DisplayName string  `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	Points      int     `json:"points"`
+}
+
+// LeaderboardQuery selects a leaderboard page either by offset or, when
+// Cursor is set, by keyset after the cursor.
+type LeaderboardQuery struct {
+	Period Period
+	Cursor *LeaderboardCursor
+	Offset int
+	Limit  int
+}
+
+type LeaderboardPage struct {
+	Period     Period             `json:"period"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	Limit      int                `json:"limit"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// UserRank is a user's position on the leaderboard. Percentile is the share
+// of users ranked at or below the user, so the leader has 100.
+type UserRank struct {
+	Period     Period  `json:"period"`
+	UserID     int     `json:"user_id"`
+	Points     int     `json:"points"`
+	Rank       int     `json:"rank"`
+	Total      int     `json:"total"`
+	Percentile float64 `json:"percentile"`
+}
+
+type LeaderboardAround struct {
+	UserRank
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// ReferralStats summarises a user's direct referrals. Active referrals have
+// at least one approved task completion.
+type ReferralStats struct {
+	DirectReferrals int          `json:"direct_referrals"`
+	ActiveReferrals int          `json:"active_referrals"`
+	TotalCommission int          `json:"total_commission"`
+	Signups         []DailyCount `json:"signups"`
+}
+
+type TransactionsPage struct {
+	Transactions []PointTransaction `json:"transactions"`
+	NextCursor   string             `json:"next_cursor,omitempty"`
+}
+
+// EmailVerification is a pending confirmation that the user controls Email.
+// Once used, Email becomes the user's address.
+type EmailVerification struct {
+	ID        int64
+	UserID    int
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	ID        int64
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
 }
 
 type UserClaims struct {
 	jwt.RegisteredClaims
 	Email string
+	Role  Role `json:"role"`
+}
+
+func (c *UserClaims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
 }
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCompletionAt(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	at := func(year int, month time.Month, day, hour, minute int, loc *time.Location) *time.Time {
+		v := time.Date(year, month, day, hour, minute, 0, 0, loc)
+		return &v
+	}
+	twelve, three := 12, 3
+
+	tests := []struct {
+		name        string
+		task        Task
+		completions int
+		last        *time.Time
+		wantNext    time.Time
+		wantOK      bool
+	}{
+		{
+			name:   "never completed",
+			task:   Task{Recurrence: RecurrenceOnce},
+			wantOK: true,
+		},
+		{
+			name:        "once after completion",
+			task:        Task{Recurrence: RecurrenceOnce},
+			completions: 1,
+			last:        at(2026, 3, 10, 12, 0, time.UTC),
+			wantOK:      false,
+		},
+		{
+			name:        "daily just before midnight",
+			task:        Task{Recurrence: RecurrenceDaily},
+			completions: 1,
+			last:        at(2026, 3, 10, 23, 59, time.UTC),
+			wantNext:    *at(2026, 3, 11, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "daily uses the UTC day",
+			task:        Task{Recurrence: RecurrenceDaily},
+			completions: 1,
+			last:        at(2026, 3, 10, 1, 0, msk),
+			wantNext:    *at(2026, 3, 10, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "weekly on monday",
+			task:        Task{Recurrence: RecurrenceWeekly},
+			completions: 1,
+			last:        at(2026, 3, 9, 0, 0, time.UTC),
+			wantNext:    *at(2026, 3, 16, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "weekly on sunday",
+			task:        Task{Recurrence: RecurrenceWeekly},
+			completions: 1,
+			last:        at(2026, 3, 15, 23, 59, time.UTC),
+			wantNext:    *at(2026, 3, 16, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "weekly uses the UTC week",
+			task:        Task{Recurrence: RecurrenceWeekly},
+			completions: 1,
+			last:        at(2026, 3, 16, 1, 0, msk),
+			wantNext:    *at(2026, 3, 16, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "weekly across the new year",
+			task:        Task{Recurrence: RecurrenceWeekly},
+			completions: 1,
+			last:        at(2026, 12, 31, 12, 0, time.UTC),
+			wantNext:    *at(2027, 1, 4, 0, 0, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "interval",
+			task:        Task{Recurrence: RecurrenceInterval, IntervalHours: &twelve},
+			completions: 1,
+			last:        at(2026, 3, 10, 18, 30, time.UTC),
+			wantNext:    *at(2026, 3, 11, 6, 30, time.UTC),
+			wantOK:      true,
+		},
+		{
+			name:        "interval without hours",
+			task:        Task{Recurrence: RecurrenceInterval},
+			completions: 1,
+			last:        at(2026, 3, 10, 18, 30, time.UTC),
+			wantOK:      false,
+		},
+		{
+			name:        "max completions reached",
+			task:        Task{Recurrence: RecurrenceDaily, MaxCompletions: &three},
+			completions: 3,
+			last:        at(2026, 3, 10, 12, 0, time.UTC),
+			wantOK:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := tt.task.NextCompletionAt(tt.completions, tt.last)
+			if ok != tt.wantOK || !next.Equal(tt.wantNext) {
+				t.Errorf("NextCompletionAt() = %v, %v, want %v, %v", next, ok, tt.wantNext, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRewardAt(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	starts := created.AddDate(0, 0, 5)
+
+	tests := []struct {
+		name string
+		task Task
+		now  time.Time
+		want int
+	}{
+		{
+			name: "no decay",
+			task: Task{Reward: 100, CreatedAt: created},
+			now:  created.AddDate(0, 0, 30),
+			want: 100,
+		},
+		{
+			name: "first day",
+			task: Task{Reward: 100, RewardDecayPerDay: 10, CreatedAt: created},
+			now:  created.Add(23 * time.Hour),
+			want: 100,
+		},
+		{
+			name: "full days only",
+			task: Task{Reward: 100, RewardDecayPerDay: 10, CreatedAt: created},
+			now:  created.Add(3*24*time.Hour + 23*time.Hour),
+			want: 70,
+		},
+		{
+			name: "floor at min reward",
+			task: Task{Reward: 100, RewardDecayPerDay: 10, MinReward: 25, CreatedAt: created},
+			now:  created.AddDate(0, 0, 30),
+			want: 25,
+		},
+		{
+			name: "decays from starts_at",
+			task: Task{Reward: 100, RewardDecayPerDay: 10, CreatedAt: created, StartsAt: &starts},
+			now:  starts.AddDate(0, 0, 2),
+			want: 80,
+		},
+		{
+			name: "before starts_at",
+			task: Task{Reward: 100, RewardDecayPerDay: 10, CreatedAt: created, StartsAt: &starts},
+			now:  created.AddDate(0, 0, 1),
+			want: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.task.RewardAt(tt.now); got != tt.want {
+				t.Errorf("RewardAt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package ledgerrepo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ledgerRepository struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewLedgerRepository(pool *pgxpool.Pool, log *slog.Logger) repository.LedgerRepository {
+	return &ledgerRepository{
+		pool: pool,
+		log:  log,
+	}
+}
+
+// GetUserTransactions returns the user's ledger entries newest first.
+// A zero cursor starts from the latest entry, otherwise only entries with
+// an id lower than the cursor are returned.
+func (repo *ledgerRepository) GetUserTransactions(ctx context.Context, userID int, cursor int64, limit int) ([]models.PointTransaction, error) {
+	query := `
+		SELECT id, user_id, delta, reason, task_id, source_user_id, created_at
+		FROM point_transactions
+		WHERE user_id = $1 AND ($2::bigint = 0 OR id < $2::bigint)
+		ORDER BY id DESC
+		LIMIT $3;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int64("cursor", cursor), slog.Int("limit", limit))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID, cursor, limit)
+	if err != nil {
+		repo.log.Error("Failed to get transactions", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.PointTransaction
+	for rows.Next() {
+		var t models.PointTransaction
+		err := rows.Scan(&t.ID, &t.UserID, &t.Delta, &t.Reason, &t.TaskID, &t.SourceUserID, &t.CreatedAt)
+		if err != nil {
+			repo.log.Error("Failed to scan transaction", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+// ListDriftedUsers returns the users whose cached users.points balance does
+// not match the sum of their ledger entries. The comparison is made on a
+// single snapshot, so a user may show up only because points were being
+// added at that moment; UserRepository.ReconcilePoints settles that.
+func (repo *ledgerRepository) ListDriftedUsers(ctx context.Context) ([]int, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		LEFT JOIN point_transactions pt ON pt.user_id = u.id
+		GROUP BY u.id
+		HAVING u.points <> COALESCE(SUM(pt.delta), 0)
+		ORDER BY u.id;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query)
+	if err != nil {
+		repo.log.Error("Failed to list drifted balances", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		repo.log.Error("Failed to scan drifted balances", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return ids, nil
+}
@@ -2,21 +2,91 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/dorik33/DeNet/internal/models"
 )
 
+// TxManager runs a unit of work in a single database transaction. Repository
+// calls made with the ctx passed to fn take part in that transaction.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit runs fn once the transaction bound to ctx commits, or right
+	// away outside of a transaction.
+	AfterCommit(ctx context.Context, fn func())
+}
+
 type UserRepository interface {
-	CreateUser(ctx context.Context, email string, password []byte) error
+	CreateUser(ctx context.Context, email string, password []byte, referralCode string) (int, error)
 	GetUserByID(ctx context.Context, id int) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByReferralCode(ctx context.Context, code string) (*models.User, error)
+	SetReferralCode(ctx context.Context, userID int, code string) error
 	SetReferrer(ctx context.Context, userID int, referrerID int) error
-	GetLeaderboard(ctx context.Context, limit int) ([]models.User, error)
-	AddPoints(ctx context.Context, userID int, points int) error
+	LockReferralGraph(ctx context.Context) error
+	IsInReferralChain(ctx context.Context, userID int, referrerID int) (bool, error)
+	GetReferrerChain(ctx context.Context, userID int, depth int) ([]models.User, error)
+	GetDownline(ctx context.Context, userID int, depth int) ([]models.ReferralNode, error)
+	GetReferralStats(ctx context.Context, userID int) (*models.ReferralStats, error)
+	GetReferralSignups(ctx context.Context, userID int, since time.Time) ([]models.DailyCount, error)
+	GetLeaderboard(ctx context.Context, since *time.Time, cursor *models.LeaderboardCursor, offset int, limit int) ([]models.User, error)
+	GetLeaderboardBefore(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor, limit int) ([]models.User, error)
+	CountRankedAhead(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor) (int, int, error)
+	GetPeriodPoints(ctx context.Context, userID int, since time.Time) (int, bool, error)
+	ListLeaderboardPositions(ctx context.Context) ([]models.LeaderboardCursor, error)
+	GetLeaderboardUsers(ctx context.Context, ids []int) ([]models.User, error)
+	AddPoints(ctx context.Context, entry *models.PointTransaction) error
+	ReconcilePoints(ctx context.Context, userID int) (int, error)
+	UpdateProfile(ctx context.Context, user *models.User) error
+	SetPassword(ctx context.Context, userID int, password []byte) error
+	SetVerifiedEmail(ctx context.Context, userID int, email string) error
+	SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error
+	GetTokensValidAfter(ctx context.Context, userID int) (*time.Time, error)
+	SetRole(ctx context.Context, userID int, role models.Role) error
 }
 
 type TaskRepository interface {
-	CompleteTask(ctx context.Context, userID int, taskID int) error
+	CompleteTask(ctx context.Context, submission *models.Submission) error
+	GetSubmission(ctx context.Context, id int64) (*models.Submission, error)
+	ListSubmissions(ctx context.Context, status models.SubmissionStatus, limit int, offset int) ([]models.Submission, error)
+	ReviewSubmission(ctx context.Context, submission *models.Submission) error
+	LockUserTask(ctx context.Context, userID int, taskID int) error
+	ReserveCompletion(ctx context.Context, taskID int) error
+	ReleaseCompletion(ctx context.Context, taskID int) error
+	GetCompletionStats(ctx context.Context, userID int, taskID int) (int, *time.Time, error)
 	GetTaskByID(ctx context.Context, id int) (*models.Task, error)
 	GetUserTasks(ctx context.Context, userID int) ([]models.Task, error)
+	ListTasks(ctx context.Context, filter models.TaskFilter) ([]models.Task, int, error)
+	ListUserTasks(ctx context.Context, userID int, filter models.TaskFilter) ([]models.TaskProgress, int, error)
+	CreateTask(ctx context.Context, task *models.Task) error
+	UpdateTask(ctx context.Context, task *models.Task) error
+	ArchiveTask(ctx context.Context, id int) error
+	SetPrerequisites(ctx context.Context, taskID int, requiredIDs []int) error
+	HasPrerequisiteCycle(ctx context.Context, taskID int) (bool, error)
+	GetUnmetPrerequisites(ctx context.Context, userID int, taskID int) ([]int, error)
+}
+
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int64) error
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+	RevokeAccessToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	CreateEmailVerification(ctx context.Context, verification *models.EmailVerification) error
+	GetEmailVerification(ctx context.Context, id int64) (*models.EmailVerification, error)
+	MarkEmailVerificationUsed(ctx context.Context, id int64) error
+	InvalidateEmailVerifications(ctx context.Context, userID int, exceptID int64) error
+}
+
+type WebhookRepository interface {
+	LinkAccount(ctx context.Context, provider string, externalID string, userID int) error
+	GetLinkedUserID(ctx context.Context, provider string, externalID string) (int, error)
+	RecordEvent(ctx context.Context, event *models.WebhookEvent) error
+}
+
+type LedgerRepository interface {
+	GetUserTransactions(ctx context.Context, userID int, cursor int64, limit int) ([]models.PointTransaction, error)
+	ListDriftedUsers(ctx context.Context) ([]int, error)
 }
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type txKey struct{}
+
+type hooksKey struct{}
+
+// txHooks collects the functions registered with AfterCommit during a
+// transaction.
+type txHooks struct {
+	fns []func()
+}
+
+// Querier is the subset of pgx used by repositories. It is implemented both
+// by *pgxpool.Pool and by pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Conn returns the transaction bound to ctx by TxManager, or the pool when
+// the call is not part of a unit of work.
+func Conn(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+// AfterCommit runs fn once the transaction bound to ctx has committed and
+// drops it if the transaction rolls back. Outside of a transaction fn runs
+// right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	if hooks, ok := ctx.Value(hooksKey{}).(*txHooks); ok {
+		hooks.fns = append(hooks.fns, fn)
+		return
+	}
+	fn()
+}
+
+type txManager struct {
+	pool *pgxpool.Pool
+}
+
+func NewTxManager(pool *pgxpool.Pool) repository.TxManager {
+	return &txManager{pool: pool}
+}
+
+func (m *txManager) AfterCommit(ctx context.Context, fn func()) {
+	AfterCommit(ctx, fn)
+}
+
+// WithinTx runs fn in a transaction. Nested calls join the outer
+// transaction, so only the outermost call commits or rolls back.
+func (m *txManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Releases the connection if fn panics. It is a no-op once the
+	// transaction has been committed or rolled back.
+	defer tx.Rollback(ctx)
+
+	hooks := &txHooks{}
+	txCtx := context.WithValue(context.WithValue(ctx, txKey{}, tx), hooksKey{}, hooks)
+	if err := fn(txCtx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, hook := range hooks.fns {
+		hook()
+	}
+	return nil
+}
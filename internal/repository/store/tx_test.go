@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newTestPool connects to the database in TEST_DATABASE_URL and creates an
+// empty scratch table for the test. Tests are skipped without it.
+func newTestPool(t *testing.T) (*pgxpool.Pool, string) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	table := fmt.Sprintf("tx_test_%d", time.Now().UnixNano())
+	_, err = pool.Exec(ctx, "CREATE TABLE "+table+" (id INTEGER PRIMARY KEY)")
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP TABLE "+table)
+	})
+	return pool, table
+}
+
+func countRows(t *testing.T, pool *pgxpool.Pool, table string) int {
+	t.Helper()
+
+	var n int
+	err := pool.QueryRow(context.Background(), "SELECT count(*) FROM "+table).Scan(&n)
+	if err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	return n
+}
+
+func TestWithinTxRollsBackOnError(t *testing.T) {
+	pool, table := newTestPool(t)
+	m := NewTxManager(pool)
+	errFail := errors.New("fail")
+
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		_, err := Conn(ctx, pool).Exec(ctx, "INSERT INTO "+table+" (id) VALUES (1)")
+		if err != nil {
+			return err
+		}
+		// A nested call joins the transaction instead of committing.
+		err = m.WithinTx(ctx, func(ctx context.Context) error {
+			_, err := Conn(ctx, pool).Exec(ctx, "INSERT INTO "+table+" (id) VALUES (2)")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("WithinTx() error = %v, want %v", err, errFail)
+	}
+
+	if n := countRows(t, pool, table); n != 0 {
+		t.Errorf("rows after rollback = %d, want 0", n)
+	}
+}
+
+func TestWithinTxRollsBackOnPanic(t *testing.T) {
+	pool, table := newTestPool(t)
+	m := NewTxManager(pool)
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("WithinTx() did not propagate the panic")
+			}
+		}()
+		m.WithinTx(context.Background(), func(ctx context.Context) error {
+			_, err := Conn(ctx, pool).Exec(ctx, "INSERT INTO "+table+" (id) VALUES (1)")
+			if err != nil {
+				return err
+			}
+			panic("fail")
+		})
+	}()
+
+	if n := pool.Stat().AcquiredConns(); n != 0 {
+		t.Errorf("connections still acquired after panic = %d, want 0", n)
+	}
+	if n := countRows(t, pool, table); n != 0 {
+		t.Errorf("rows after panic = %d, want 0", n)
+	}
+}
+
+func TestWithinTxAfterCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    bool
+		wantRun bool
+	}{
+		{name: "commit", fail: false, wantRun: true},
+		{name: "rollback", fail: true, wantRun: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, table := newTestPool(t)
+			m := NewTxManager(pool)
+
+			ran, rowsSeen := false, -1
+			m.WithinTx(context.Background(), func(ctx context.Context) error {
+				_, err := Conn(ctx, pool).Exec(ctx, "INSERT INTO "+table+" (id) VALUES (1)")
+				if err != nil {
+					return err
+				}
+				m.AfterCommit(ctx, func() {
+					ran = true
+					rowsSeen = countRows(t, pool, table)
+				})
+				if ran {
+					t.Error("hook ran before the transaction ended")
+				}
+				if tt.fail {
+					return errors.New("fail")
+				}
+				return nil
+			})
+
+			if ran != tt.wantRun {
+				t.Fatalf("hook ran = %v, want %v", ran, tt.wantRun)
+			}
+			if ran && rowsSeen != 1 {
+				t.Errorf("rows seen by hook = %d, want 1", rowsSeen)
+			}
+		})
+	}
+}
+
+func TestAfterCommitOutsideTx(t *testing.T) {
+	ran := false
+	AfterCommit(context.Background(), func() { ran = true })
+	if !ran {
+		t.Error("hook did not run outside of a transaction")
+	}
+}
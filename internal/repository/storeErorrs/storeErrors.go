@@ -3,8 +3,19 @@ package storeerrors
 import "errors"
 
 var (
-	ErrTaskCompleted = errors.New("task already complete")
-	ErrTaskNotFound  = errors.New("task not found")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrUserExists    = errors.New("user aldready exists")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrTaskExists         = errors.New("task already exists")
+	ErrCapReached         = errors.New("task completion cap reached")
+	ErrPrerequisiteCycle  = errors.New("prerequisite cycle")
+	ErrUnknownPrereq      = errors.New("unknown prerequisite")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user aldready exists")
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrInvalidSort        = errors.New("invalid sort")
+	ErrSubmissionNotFound = errors.New("submission not found")
+	ErrAccountLinked      = errors.New("account already linked")
+	ErrEventExists        = errors.New("event already recorded")
+	ErrReferralCodeTaken  = errors.New("referral code taken")
+	ErrReferrerSet        = errors.New("referrer already set")
+	ErrDisplayNameTaken   = errors.New("display name taken")
 )
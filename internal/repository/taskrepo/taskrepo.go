@@ -3,16 +3,57 @@ package taskrepo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/dorik33/DeNet/internal/models"
 	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
 	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// taskColumns is the column list scanned by scanTask.
+const taskColumns = `t.id, t.name, t.description, t.reward, t.recurrence, t.interval_hours, t.max_completions, t.min_points,
+	ARRAY(SELECT tp.required_task_id FROM task_prerequisites tp WHERE tp.task_id = t.id ORDER BY tp.required_task_id),
+	t.starts_at, t.ends_at, t.completion_cap, t.completion_count, t.reward_decay_per_day, t.min_reward,
+	t.verification, t.provider, t.created_at, t.archived_at`
+
+// scanTask scans taskColumns followed by any extra selected columns.
+func scanTask(row pgx.Row, extra ...any) (*models.Task, error) {
+	var task models.Task
+	dest := append([]any{
+		&task.ID,
+		&task.Name,
+		&task.Description,
+		&task.Reward,
+		&task.Recurrence,
+		&task.IntervalHours,
+		&task.MaxCompletions,
+		&task.MinPoints,
+		&task.Prerequisites,
+		&task.StartsAt,
+		&task.EndsAt,
+		&task.CompletionCap,
+		&task.CompletionCount,
+		&task.RewardDecayPerDay,
+		&task.MinReward,
+		&task.Verification,
+		&task.Provider,
+		&task.CreatedAt,
+		&task.ArchivedAt,
+	}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
 type taskRepository struct {
 	pool *pgxpool.Pool
 	log  *slog.Logger
@@ -25,22 +66,31 @@ func NewTaskRepository(pool *pgxpool.Pool, log *slog.Logger) repository.TaskRepo
 	}
 }
 
-func (repo *taskRepository) CompleteTask(ctx context.Context, userID int, taskID int) error {
+// CompleteTask records a completion with the submission's status and proof,
+// filling in its id and completion time.
+func (repo *taskRepository) CompleteTask(ctx context.Context, submission *models.Submission) error {
 	query := `
-		INSERT INTO user_tasks (user_id, task_id, completed_at)
-		VALUES ($1, $2, now());
+		INSERT INTO user_tasks (user_id, task_id, completed_at, status, proof_type, proof_value)
+		VALUES ($1, $2, now(), $3, $4, $5)
+		RETURNING id, completed_at;
 	`
 
-	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("task_id", taskID))
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", submission.UserID), slog.Int("task_id", submission.TaskID))
+
+	var proofType, proofValue *string
+	if submission.Proof != nil {
+		t := string(submission.Proof.Type)
+		proofType, proofValue = &t, &submission.Proof.Value
+	}
 
-	_, err := repo.pool.Exec(ctx, query, userID, taskID)
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query,
+		submission.UserID,
+		submission.TaskID,
+		submission.Status,
+		proofType,
+		proofValue,
+	).Scan(&submission.ID, &submission.CompletedAt)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23505" {
-				return storeerrors.ErrTaskCompleted
-			}
-		}
 		repo.log.Error("Failed to complete task", slog.String("error", err.Error()))
 		return err
 	}
@@ -48,23 +98,219 @@ func (repo *taskRepository) CompleteTask(ctx context.Context, userID int, taskID
 	return nil
 }
 
+// submissionColumns is the column list scanned by scanSubmission.
+const submissionColumns = `ut.id, ut.user_id, ut.task_id, t.name, ut.status, ut.proof_type, ut.proof_value,
+	ut.completed_at, ut.reviewed_by, ut.reviewed_at, ut.review_comment`
+
+func scanSubmission(row pgx.Row) (*models.Submission, error) {
+	var (
+		submission models.Submission
+		proofType  *string
+		proofValue *string
+	)
+	err := row.Scan(
+		&submission.ID,
+		&submission.UserID,
+		&submission.TaskID,
+		&submission.TaskName,
+		&submission.Status,
+		&proofType,
+		&proofValue,
+		&submission.CompletedAt,
+		&submission.ReviewedBy,
+		&submission.ReviewedAt,
+		&submission.ReviewComment,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if proofType != nil {
+		submission.Proof = &models.TaskProof{Type: models.ProofType(*proofType)}
+		if proofValue != nil {
+			submission.Proof.Value = *proofValue
+		}
+	}
+	return &submission, nil
+}
+
+// GetSubmission returns a submission and locks it until the end of the
+// transaction.
+func (repo *taskRepository) GetSubmission(ctx context.Context, id int64) (*models.Submission, error) {
+	query := `
+		SELECT ` + submissionColumns + `
+		FROM user_tasks ut
+		INNER JOIN tasks t ON t.id = ut.task_id
+		WHERE ut.id = $1
+		FOR UPDATE OF ut;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int64("id", id))
+
+	submission, err := scanSubmission(store.Conn(ctx, repo.pool).QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storeerrors.ErrSubmissionNotFound
+		}
+		repo.log.Error("Failed to get submission", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return submission, nil
+}
+
+// ListSubmissions returns submissions with the given status, oldest first.
+func (repo *taskRepository) ListSubmissions(ctx context.Context, status models.SubmissionStatus, limit int, offset int) ([]models.Submission, error) {
+	query := `
+		SELECT ` + submissionColumns + `
+		FROM user_tasks ut
+		INNER JOIN tasks t ON t.id = ut.task_id
+		WHERE ut.status = $1
+		ORDER BY ut.completed_at, ut.id
+		LIMIT $2 OFFSET $3;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("status", string(status)))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, status, limit, offset)
+	if err != nil {
+		repo.log.Error("Failed to list submissions", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var submissions []models.Submission
+	for rows.Next() {
+		s, err := scanSubmission(rows)
+		if err != nil {
+			repo.log.Error("Failed to scan submission", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("failed to scan submission: %w", err)
+		}
+		submissions = append(submissions, *s)
+	}
+
+	return submissions, rows.Err()
+}
+
+// ReviewSubmission moves a pending submission to approved or rejected.
+func (repo *taskRepository) ReviewSubmission(ctx context.Context, submission *models.Submission) error {
+	query := `
+		UPDATE user_tasks
+		SET status = $1, reviewed_by = $2, reviewed_at = $3, review_comment = $4
+		WHERE id = $5 AND status = 'pending';
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int64("id", submission.ID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query,
+		submission.Status,
+		submission.ReviewedBy,
+		submission.ReviewedAt,
+		submission.ReviewComment,
+		submission.ID,
+	)
+	if err != nil {
+		repo.log.Error("Failed to review submission", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrSubmissionNotFound
+	}
+	return nil
+}
+
+// ReleaseCompletion gives back a slot reserved by ReserveCompletion.
+func (repo *taskRepository) ReleaseCompletion(ctx context.Context, taskID int) error {
+	query := `
+		UPDATE tasks
+		SET completion_count = completion_count - 1
+		WHERE id = $1 AND completion_count > 0;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("task_id", taskID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, taskID)
+	if err != nil {
+		repo.log.Error("Failed to release completion", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// ReserveCompletion counts one more user against the task's global cap.
+// The conditional update locks the task row until the transaction ends, so
+// concurrent completions can never push the count past the cap.
+func (repo *taskRepository) ReserveCompletion(ctx context.Context, taskID int) error {
+	query := `
+		UPDATE tasks
+		SET completion_count = completion_count + 1
+		WHERE id = $1 AND (completion_cap IS NULL OR completion_count < completion_cap);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("task_id", taskID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, taskID)
+	if err != nil {
+		repo.log.Error("Failed to reserve completion", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrCapReached
+	}
+	return nil
+}
+
+// LockUserTask takes a transaction-scoped advisory lock on the (user, task)
+// pair so that concurrent completions are checked against the recurrence
+// policy one at a time. It must be called inside a transaction.
+func (repo *taskRepository) LockUserTask(ctx context.Context, userID int, taskID int) error {
+	query := `
+		SELECT pg_advisory_xact_lock($1, $2);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("task_id", taskID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, userID, taskID)
+	if err != nil {
+		repo.log.Error("Failed to lock user task", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// GetCompletionStats returns how many times the user completed the task and
+// when they did it last. Pending submissions count, rejected ones do not.
+func (repo *taskRepository) GetCompletionStats(ctx context.Context, userID int, taskID int) (int, *time.Time, error) {
+	query := `
+		SELECT COUNT(*), MAX(completed_at)
+		FROM user_tasks
+		WHERE user_id = $1 AND task_id = $2 AND status <> 'rejected';
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("task_id", taskID))
+
+	var (
+		count int
+		last  *time.Time
+	)
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, userID, taskID).Scan(&count, &last)
+	if err != nil {
+		repo.log.Error("Failed to get completion stats", slog.String("error", err.Error()))
+		return 0, nil, err
+	}
+	return count, last, nil
+}
+
 func (repo *taskRepository) GetTaskByID(ctx context.Context, id int) (*models.Task, error) {
 	query := `
-        SELECT id, name, description, reward, created_at
-        FROM tasks
-        WHERE id = $1;
+        SELECT ` + taskColumns + `
+        FROM tasks t
+        WHERE t.id = $1;
     `
 
 	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("id", id))
 
-	var task models.Task
-	err := repo.pool.QueryRow(ctx, query, id).Scan(
-		&task.ID,
-		&task.Name,
-		&task.Description,
-		&task.Reward,
-		&task.CreatedAt,
-	)
+	task, err := scanTask(store.Conn(ctx, repo.pool).QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, storeerrors.ErrTaskNotFound
@@ -72,20 +318,23 @@ func (repo *taskRepository) GetTaskByID(ctx context.Context, id int) (*models.Ta
 		repo.log.Error("Failed to get task", slog.String("error", err.Error()))
 		return nil, err
 	}
-	return &task, nil
+	return task, nil
 }
 
+// GetUserTasks returns the tasks the user has completed, once per task even
+// if a repeatable task was completed several times.
 func (repo *taskRepository) GetUserTasks(ctx context.Context, userID int) ([]models.Task, error) {
 	query := `
-        SELECT t.id, t.name, t.description, t.reward
+        SELECT DISTINCT ON (ut.task_id) ` + taskColumns + `
         FROM tasks t
         INNER JOIN user_tasks ut ON t.id = ut.task_id
-        WHERE ut.user_id = $1;
+        WHERE ut.user_id = $1 AND ut.status = 'approved'
+        ORDER BY ut.task_id, ut.completed_at DESC;
     `
 
 	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
 
-	rows, err := repo.pool.Query(ctx, query, userID)
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID)
 	if err != nil {
 		repo.log.Error("Failed to get completed tasks", slog.String("error", err.Error()))
 		return nil, err
@@ -94,13 +343,358 @@ func (repo *taskRepository) GetUserTasks(ctx context.Context, userID int) ([]mod
 
 	var tasks []models.Task
 	for rows.Next() {
-		var t models.Task
-		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Reward); err != nil {
+		t, err := scanTask(rows)
+		if err != nil {
 			repo.log.Error("Failed to scan task", slog.String("error", err.Error()))
 			return nil, err
 		}
-		tasks = append(tasks, t)
+		tasks = append(tasks, *t)
 	}
 
-	return tasks, nil
+	return tasks, rows.Err()
+}
+
+// taskSorts maps the public sort keys to ORDER BY clauses. The id is always
+// the last key so that pages are stable.
+var taskSorts = map[string]string{
+	"":            "t.id",
+	"id":          "t.id",
+	"reward":      "t.reward, t.id",
+	"-reward":     "t.reward DESC, t.id",
+	"created_at":  "t.created_at, t.id",
+	"-created_at": "t.created_at DESC, t.id",
+}
+
+// filterClause builds the WHERE conditions for a catalog filter, appending
+// the query arguments to args.
+func filterClause(filter models.TaskFilter, args []any) (string, []any) {
+	conditions := []string{"t.archived_at IS NULL", "(t.ends_at IS NULL OR t.ends_at > now())"}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		conditions = append(conditions, fmt.Sprintf("(t.name ILIKE $%d OR t.description ILIKE $%d)", len(args), len(args)))
+	}
+	if filter.MinReward != nil {
+		args = append(args, *filter.MinReward)
+		conditions = append(conditions, fmt.Sprintf("t.reward >= $%d", len(args)))
+	}
+	if filter.MaxReward != nil {
+		args = append(args, *filter.MaxReward)
+		conditions = append(conditions, fmt.Sprintf("t.reward <= $%d", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (repo *taskRepository) ListTasks(ctx context.Context, filter models.TaskFilter) ([]models.Task, int, error) {
+	orderBy, ok := taskSorts[filter.Sort]
+	if !ok {
+		return nil, 0, storeerrors.ErrInvalidSort
+	}
+	where, args := filterClause(filter, nil)
+	args = append(args, filter.Limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+		SELECT `+taskColumns+`, COUNT(*) OVER ()
+		FROM tasks t
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d;
+	`, where, orderBy, len(args)-1, len(args))
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, args...)
+	if err != nil {
+		repo.log.Error("Failed to list tasks", slog.String("error", err.Error()))
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		tasks []models.Task
+		total int
+	)
+	for rows.Next() {
+		t, err := scanTask(rows, &total)
+		if err != nil {
+			repo.log.Error("Failed to scan task", slog.String("error", err.Error()))
+			return nil, 0, fmt.Errorf("failed to scan task: %w", err)
+		}
+		tasks = append(tasks, *t)
+	}
+
+	return tasks, total, rows.Err()
+}
+
+// ListUserTasks returns the catalog annotated with the user's last
+// completion of every task.
+func (repo *taskRepository) ListUserTasks(ctx context.Context, userID int, filter models.TaskFilter) ([]models.TaskProgress, int, error) {
+	orderBy, ok := taskSorts[filter.Sort]
+	if !ok {
+		return nil, 0, storeerrors.ErrInvalidSort
+	}
+	where, args := filterClause(filter, []any{userID})
+	args = append(args, filter.Limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+		SELECT `+taskColumns+`, ut.completions, ut.completed_at, ut.pending,
+			(t.starts_at IS NOT NULL AND t.starts_at > now())
+				OR (t.completion_cap IS NOT NULL AND t.completion_count >= t.completion_cap AND ut.completions = 0)
+				OR t.min_points > COALESCE((SELECT points FROM users WHERE id = $1), 0)
+				OR EXISTS (
+					SELECT 1
+					FROM task_prerequisites tp
+					WHERE tp.task_id = t.id AND NOT EXISTS (
+						SELECT 1 FROM user_tasks done
+						WHERE done.user_id = $1 AND done.task_id = tp.required_task_id AND done.status = 'approved'
+					)
+				),
+			COUNT(*) OVER ()
+		FROM tasks t
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) FILTER (WHERE status <> 'rejected') AS completions,
+				MAX(completed_at) FILTER (WHERE status <> 'rejected') AS completed_at,
+				COALESCE(bool_or(status = 'pending'), false) AS pending
+			FROM user_tasks
+			WHERE user_id = $1 AND task_id = t.id
+		) ut ON true
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d;
+	`, where, orderBy, len(args)-1, len(args))
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, args...)
+	if err != nil {
+		repo.log.Error("Failed to list user tasks", slog.String("error", err.Error()))
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		tasks []models.TaskProgress
+		total int
+	)
+	for rows.Next() {
+		var progress models.TaskProgress
+		t, err := scanTask(rows, &progress.Completions, &progress.CompletedAt, &progress.Pending, &progress.Locked, &total)
+		if err != nil {
+			repo.log.Error("Failed to scan task", slog.String("error", err.Error()))
+			return nil, 0, fmt.Errorf("failed to scan task: %w", err)
+		}
+		progress.Task = *t
+		tasks = append(tasks, progress)
+	}
+
+	return tasks, total, rows.Err()
+}
+
+func (repo *taskRepository) CreateTask(ctx context.Context, task *models.Task) error {
+	query := `
+		INSERT INTO tasks (
+			name, description, reward, recurrence, interval_hours, max_completions, min_points,
+			starts_at, ends_at, completion_cap, reward_decay_per_day, min_reward, verification, provider
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_at;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("name", task.Name))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query,
+		task.Name,
+		task.Description,
+		task.Reward,
+		task.Recurrence,
+		task.IntervalHours,
+		task.MaxCompletions,
+		task.MinPoints,
+		task.StartsAt,
+		task.EndsAt,
+		task.CompletionCap,
+		task.RewardDecayPerDay,
+		task.MinReward,
+		task.Verification,
+		task.Provider,
+	).Scan(&task.ID, &task.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storeerrors.ErrTaskExists
+			}
+		}
+		repo.log.Error("Failed to create task", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *taskRepository) UpdateTask(ctx context.Context, task *models.Task) error {
+	query := `
+		UPDATE tasks
+		SET name = $1, description = $2, reward = $3, recurrence = $4, interval_hours = $5, max_completions = $6, min_points = $7,
+			starts_at = $8, ends_at = $9, completion_cap = $10, reward_decay_per_day = $11, min_reward = $12,
+			verification = $13, provider = $14
+		WHERE id = $15
+		RETURNING completion_count, created_at, archived_at;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("id", task.ID))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query,
+		task.Name,
+		task.Description,
+		task.Reward,
+		task.Recurrence,
+		task.IntervalHours,
+		task.MaxCompletions,
+		task.MinPoints,
+		task.StartsAt,
+		task.EndsAt,
+		task.CompletionCap,
+		task.RewardDecayPerDay,
+		task.MinReward,
+		task.Verification,
+		task.Provider,
+		task.ID,
+	).Scan(&task.CompletionCount, &task.CreatedAt, &task.ArchivedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storeerrors.ErrTaskNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storeerrors.ErrTaskExists
+			}
+		}
+		repo.log.Error("Failed to update task", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// ArchiveTask soft-deletes a task. Archived tasks keep their completions but
+// are hidden from the catalog.
+func (repo *taskRepository) ArchiveTask(ctx context.Context, id int) error {
+	query := `
+		UPDATE tasks
+		SET archived_at = now()
+		WHERE id = $1 AND archived_at IS NULL;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("id", id))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, id)
+	if err != nil {
+		repo.log.Error("Failed to archive task", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrTaskNotFound
+	}
+	return nil
+}
+
+// SetPrerequisites replaces the set of tasks that must be completed before
+// taskID. The prerequisite graph is locked until the end of the transaction
+// so that concurrent edits cannot sneak a cycle past HasPrerequisiteCycle.
+func (repo *taskRepository) SetPrerequisites(ctx context.Context, taskID int, requiredIDs []int) error {
+	conn := store.Conn(ctx, repo.pool)
+
+	query := `
+		LOCK TABLE task_prerequisites IN SHARE ROW EXCLUSIVE MODE;
+	`
+	repo.log.Debug("Executing query", slog.String("query", query))
+	if _, err := conn.Exec(ctx, query); err != nil {
+		repo.log.Error("Failed to lock prerequisites", slog.String("error", err.Error()))
+		return err
+	}
+
+	query = `
+		DELETE FROM task_prerequisites
+		WHERE task_id = $1;
+	`
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("task_id", taskID))
+	if _, err := conn.Exec(ctx, query, taskID); err != nil {
+		repo.log.Error("Failed to clear prerequisites", slog.String("error", err.Error()))
+		return err
+	}
+
+	query = `
+		INSERT INTO task_prerequisites (task_id, required_task_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING;
+	`
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("task_id", taskID))
+	if _, err := conn.Exec(ctx, query, taskID, requiredIDs); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23503" {
+				return storeerrors.ErrUnknownPrereq
+			}
+			if pgErr.Code == "23514" {
+				return storeerrors.ErrPrerequisiteCycle
+			}
+		}
+		repo.log.Error("Failed to set prerequisites", slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+// HasPrerequisiteCycle reports whether taskID is reachable from its own
+// prerequisites.
+func (repo *taskRepository) HasPrerequisiteCycle(ctx context.Context, taskID int) (bool, error) {
+	query := `
+		WITH RECURSIVE chain (task_id) AS (
+			SELECT required_task_id FROM task_prerequisites WHERE task_id = $1
+			UNION
+			SELECT tp.required_task_id
+			FROM task_prerequisites tp
+			INNER JOIN chain c ON tp.task_id = c.task_id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE task_id = $1);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("task_id", taskID))
+
+	var cycle bool
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, taskID).Scan(&cycle)
+	if err != nil {
+		repo.log.Error("Failed to check prerequisite cycle", slog.String("error", err.Error()))
+		return false, err
+	}
+	return cycle, nil
+}
+
+// GetUnmetPrerequisites returns the prerequisites of taskID the user has not
+// completed yet.
+func (repo *taskRepository) GetUnmetPrerequisites(ctx context.Context, userID int, taskID int) ([]int, error) {
+	query := `
+		SELECT tp.required_task_id
+		FROM task_prerequisites tp
+		WHERE tp.task_id = $2 AND NOT EXISTS (
+			SELECT 1 FROM user_tasks ut WHERE ut.user_id = $1 AND ut.task_id = tp.required_task_id AND ut.status = 'approved'
+		)
+		ORDER BY tp.required_task_id;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("task_id", taskID))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID, taskID)
+	if err != nil {
+		repo.log.Error("Failed to get unmet prerequisites", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	unmet, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		repo.log.Error("Failed to scan prerequisites", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return unmet, nil
 }
@@ -0,0 +1,249 @@
+package tokenrepo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type tokenRepository struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewTokenRepository(pool *pgxpool.Pool, log *slog.Logger) repository.TokenRepository {
+	return &tokenRepository{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (repo *tokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", token.UserID), slog.String("family_id", token.FamilyID))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		repo.log.Error("Failed to create refresh token", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash locks the token row so that concurrent refreshes of
+// the same token are serialized when called inside a transaction.
+func (repo *tokenRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	var token models.RefreshToken
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, hash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storeerrors.ErrTokenNotFound
+		}
+		repo.log.Error("Failed to get refresh token", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo *tokenRepository) MarkRefreshTokenUsed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = now()
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int64("id", id))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, id)
+	if err != nil {
+		repo.log.Error("Failed to mark refresh token used", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (repo *tokenRepository) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE family_id = $1 AND revoked_at IS NULL;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("family_id", familyID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, familyID)
+	if err != nil {
+		repo.log.Error("Failed to revoke refresh token family", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *tokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, userID)
+	if err != nil {
+		repo.log.Error("Failed to revoke user refresh tokens", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *tokenRepository) RevokeAccessToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("jti", jti), slog.Int("user_id", userID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, jti, userID, expiresAt)
+	if err != nil {
+		repo.log.Error("Failed to revoke access token", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *tokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("jti", jti))
+
+	var revoked bool
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, jti).Scan(&revoked)
+	if err != nil {
+		repo.log.Error("Failed to check access token revocation", slog.String("error", err.Error()))
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (repo *tokenRepository) CreateEmailVerification(ctx context.Context, verification *models.EmailVerification) error {
+	query := `
+		INSERT INTO email_verifications (user_id, email, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", verification.UserID))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, verification.UserID, verification.Email, verification.ExpiresAt).Scan(&verification.ID, &verification.CreatedAt)
+	if err != nil {
+		repo.log.Error("Failed to create email verification", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// GetEmailVerification locks the verification row so that a token can only
+// be redeemed once when called inside a transaction.
+func (repo *tokenRepository) GetEmailVerification(ctx context.Context, id int64) (*models.EmailVerification, error) {
+	query := `
+		SELECT id, user_id, email, expires_at, used_at, created_at
+		FROM email_verifications
+		WHERE id = $1
+		FOR UPDATE;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int64("id", id))
+
+	var verification models.EmailVerification
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, id).Scan(
+		&verification.ID,
+		&verification.UserID,
+		&verification.Email,
+		&verification.ExpiresAt,
+		&verification.UsedAt,
+		&verification.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storeerrors.ErrTokenNotFound
+		}
+		repo.log.Error("Failed to get email verification", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return &verification, nil
+}
+
+func (repo *tokenRepository) MarkEmailVerificationUsed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE email_verifications
+		SET used_at = now()
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int64("id", id))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, id)
+	if err != nil {
+		repo.log.Error("Failed to mark email verification used", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// InvalidateEmailVerifications marks every pending verification of the user
+// except exceptID as used.
+func (repo *tokenRepository) InvalidateEmailVerifications(ctx context.Context, userID int, exceptID int64) error {
+	query := `
+		UPDATE email_verifications
+		SET used_at = now()
+		WHERE user_id = $1 AND used_at IS NULL AND id <> $2;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int64("except_id", exceptID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, userID, exceptID)
+	if err != nil {
+		repo.log.Error("Failed to invalidate email verifications", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
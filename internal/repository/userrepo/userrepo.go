@@ -5,15 +5,31 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/dorik33/DeNet/internal/models"
 	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
 	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// userColumns is the column list scanned by scanUser.
+const userColumns = `id, email, hash_password, referrer_id, referral_code, points, role, created_at,
+	display_name, avatar_url, hide_from_leaderboard, locale, timezone, email_verified`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Email, &user.HashPassword, &user.ReferrerID, &user.ReferralCode, &user.Points, &user.Role, &user.CreatedAt,
+		&user.DisplayName, &user.AvatarURL, &user.HideFromLeaderboard, &user.Locale, &user.Timezone, &user.EmailVerified)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 type userRepository struct {
 	pool *pgxpool.Pool
 	log  *slog.Logger
@@ -26,38 +42,94 @@ func NewUserRepository(pool *pgxpool.Pool, log *slog.Logger) repository.UserRepo
 	}
 }
 
-func (repo *userRepository) CreateUser(ctx context.Context, email string, password []byte) error {
+// CreateUser inserts a user and returns its id. A clash on the referral code
+// does not abort the surrounding transaction: it is reported as
+// ErrReferralCodeTaken so that the caller can retry with another code.
+func (repo *userRepository) CreateUser(ctx context.Context, email string, password []byte, referralCode string) (int, error) {
 	query := `
-	INSERT INTO users(email, hash_password) 
-	VALUES($1, $2);
+	INSERT INTO users(email, hash_password, referral_code) 
+	VALUES($1, $2, $3)
+	ON CONFLICT (referral_code) DO NOTHING
+	RETURNING id;
 	`
 	repo.log.Debug("Executing query", slog.String("query", query), slog.String("email", email))
-	_, err := repo.pool.Exec(ctx, query, email, password)
+
+	var id int
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, email, password, referralCode).Scan(&id)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, storeerrors.ErrReferralCodeTaken
+		}
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			if pgErr.Code == "23505" {
 				repo.log.Warn("User with email already exists", slog.String("email", email))
-				return storeerrors.ErrUserExists
+				return 0, storeerrors.ErrUserExists
 			}
 		}
 
 		repo.log.Error("Failed to create user", slog.String("error", err.Error()))
+		return 0, err
+	}
+	return id, nil
+}
+
+func (repo *userRepository) GetUserByReferralCode(ctx context.Context, code string) (*models.User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE referral_code = $1;
+	`
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	user, err := scanUser(store.Conn(ctx, repo.pool).QueryRow(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storeerrors.ErrUserNotFound
+		}
+		repo.log.Error("Failed to get user", slog.String("error", err.Error()))
+
+		return nil, err
+	}
+	return user, nil
+}
+
+func (repo *userRepository) SetReferralCode(ctx context.Context, userID int, code string) error {
+	query := `
+		UPDATE users
+		SET referral_code = $1
+		WHERE id = $2;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, code, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storeerrors.ErrReferralCodeTaken
+			}
+		}
+		repo.log.Error("Failed to set referral code", slog.String("error", err.Error()))
 		return err
 	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrUserNotFound
+	}
 	return nil
 }
 
 func (repo *userRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-	SELECT id, email, hash_password, referrer_id, points, created_at
+	SELECT ` + userColumns + `
 	FROM users
 	WHERE id = $1;
 	`
 	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("id", id))
 
-	var user models.User
-	err := repo.pool.QueryRow(ctx, query, id).Scan(&user.ID, &user.Email, &user.HashPassword, &user.ReferrerID, &user.Points, &user.CreatedAt)
+	user, err := scanUser(store.Conn(ctx, repo.pool).QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, storeerrors.ErrUserNotFound
@@ -66,19 +138,18 @@ func (repo *userRepository) GetUserByID(ctx context.Context, id int) (*models.Us
 
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (repo *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-	SELECT id, email, hash_password, referrer_id, points, created_at
+	SELECT ` + userColumns + `
 	FROM users
 	WHERE email = $1;
 	`
 	repo.log.Debug("Executing query", slog.String("query", query), slog.String("email", email))
 
-	var user models.User
-	err := repo.pool.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.HashPassword, &user.ReferrerID, &user.Points, &user.CreatedAt)
+	user, err := scanUser(store.Conn(ctx, repo.pool).QueryRow(ctx, query, email))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, storeerrors.ErrUserNotFound
@@ -87,52 +158,404 @@ func (repo *userRepository) GetUserByEmail(ctx context.Context, email string) (*
 
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
+// SetReferrer sets the referrer of a user who has none yet. It returns
+// ErrReferrerSet when the user already has a referrer or does not exist, so
+// callers should check the user first.
 func (repo *userRepository) SetReferrer(ctx context.Context, userID int, referrerID int) error {
 	query := `
 		UPDATE users
-		SET referrer_id = $1
-		WHERE id = $2;
+		SET referrer_id = $1, referred_at = now()
+		WHERE id = $2 AND referrer_id IS NULL;
 	`
 
 	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("referrer_id", referrerID), slog.Int("user_id", userID))
 
-	cmdTag, err := repo.pool.Exec(ctx, query, referrerID, userID)
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, referrerID, userID)
 	if err != nil {
 		repo.log.Error("Failed to set referrer", slog.String("error", err.Error()))
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return storeerrors.ErrUserNotFound
+		return storeerrors.ErrReferrerSet
 	}
 
 	return nil
 }
 
-func (repo *userRepository) GetLeaderboard(ctx context.Context, limit int) ([]models.User, error) {
+// GetReferrerChain returns up to depth referrers above the user, the direct
+// referrer first. Only ID and EmailVerified are set.
+func (repo *userRepository) GetReferrerChain(ctx context.Context, userID int, depth int) ([]models.User, error) {
 	query := `
-	SELECT id, email, referrer_id, points, created_at
-	FROM users
-	ORDER BY points DESC
-	LIMIT $1;
+		WITH RECURSIVE chain (id, referrer_id, email_verified, level) AS (
+			SELECT id, referrer_id, email_verified, 0 FROM users WHERE id = $1
+			UNION ALL
+			SELECT u.id, u.referrer_id, u.email_verified, c.level + 1
+			FROM users u
+			INNER JOIN chain c ON u.id = c.referrer_id
+			WHERE c.level < $2
+		)
+		SELECT id, email_verified
+		FROM chain
+		WHERE level > 0
+		ORDER BY level;
 	`
 
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("depth", depth))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID, depth)
+	if err != nil {
+		repo.log.Error("Failed to get referrer chain", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	chain, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.User, error) {
+		var user models.User
+		err := row.Scan(&user.ID, &user.EmailVerified)
+		return user, err
+	})
+	if err != nil {
+		repo.log.Error("Failed to scan referrer chain", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return chain, nil
+}
+
+// GetDownline returns the users below userID in the referral tree, up to
+// depth levels, ordered by level. Every node carries the commission userID
+// earned from it.
+func (repo *userRepository) GetDownline(ctx context.Context, userID int, depth int) ([]models.ReferralNode, error) {
+	query := `
+		WITH RECURSIVE downline (id, referrer_id, level, referred_at) AS (
+			SELECT id, referrer_id, 1, referred_at FROM users WHERE referrer_id = $1
+			UNION ALL
+			SELECT u.id, u.referrer_id, d.level + 1, u.referred_at
+			FROM users u
+			INNER JOIN downline d ON u.referrer_id = d.id
+			WHERE d.level < $2
+		)
+		SELECT d.id, d.referrer_id, d.level, d.referred_at, COALESCE(c.total, 0)
+		FROM downline d
+		LEFT JOIN LATERAL (
+			SELECT SUM(pt.delta) AS total
+			FROM point_transactions pt
+			WHERE pt.user_id = $1 AND pt.source_user_id = d.id AND pt.reason = 'referral_commission'
+		) c ON true
+		ORDER BY d.level, d.id;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("depth", depth))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID, depth)
+	if err != nil {
+		repo.log.Error("Failed to get downline", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []models.ReferralNode
+	for rows.Next() {
+		var node models.ReferralNode
+		err := rows.Scan(&node.UserID, &node.ReferrerID, &node.Level, &node.ReferredAt, &node.Commission)
+		if err != nil {
+			repo.log.Error("Failed to scan referral", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("failed to scan referral: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// GetReferralStats counts the user's direct and active referrals and sums
+// the commission earned from the whole downline.
+func (repo *userRepository) GetReferralStats(ctx context.Context, userID int) (*models.ReferralStats, error) {
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM user_tasks ut WHERE ut.user_id = r.id AND ut.status = 'approved'
+			)),
+			(SELECT COALESCE(SUM(pt.delta), 0)
+				FROM point_transactions pt
+				WHERE pt.user_id = $1 AND pt.reason = 'referral_commission')
+		FROM users r
+		WHERE r.referrer_id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	var stats models.ReferralStats
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, userID).Scan(&stats.DirectReferrals, &stats.ActiveReferrals, &stats.TotalCommission)
+	if err != nil {
+		repo.log.Error("Failed to get referral stats", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetReferralSignups returns the number of users who entered the user's code
+// on every day since the given day, including days without signups.
+func (repo *userRepository) GetReferralSignups(ctx context.Context, userID int, since time.Time) ([]models.DailyCount, error) {
+	query := `
+		SELECT to_char(d.day, 'YYYY-MM-DD'), COUNT(r.id)
+		FROM generate_series($2::date, now()::date, interval '1 day') AS d(day)
+		LEFT JOIN users r
+			ON r.referrer_id = $1 AND r.referred_at >= d.day AND r.referred_at < d.day + interval '1 day'
+		GROUP BY d.day
+		ORDER BY d.day;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Time("since", since))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, userID, since)
+	if err != nil {
+		repo.log.Error("Failed to get referral signups", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var signups []models.DailyCount
+	for rows.Next() {
+		var day models.DailyCount
+		err := rows.Scan(&day.Date, &day.Count)
+		if err != nil {
+			repo.log.Error("Failed to scan referral signups", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("failed to scan referral signups: %w", err)
+		}
+		signups = append(signups, day)
+	}
+
+	return signups, rows.Err()
+}
+
+// referralGraphLock is the advisory lock key taken by LockReferralGraph.
+const referralGraphLock = 0x7265666572 // "refer"
+
+// LockReferralGraph serializes changes to referrers until the transaction
+// ends. Locking only the two users involved is not enough: two new links
+// between disjoint pairs can still close a cycle through existing ones. It
+// must run inside a transaction.
+func (repo *userRepository) LockReferralGraph(ctx context.Context) error {
+	query := `SELECT pg_advisory_xact_lock($1);`
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, int64(referralGraphLock))
+	if err != nil {
+		repo.log.Error("Failed to lock referral graph", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// IsInReferralChain reports whether userID is referrerID itself or one of the
+// users above it in the referral chain.
+func (repo *userRepository) IsInReferralChain(ctx context.Context, userID int, referrerID int) (bool, error) {
+	query := `
+		WITH RECURSIVE chain (id, referrer_id) AS (
+			SELECT id, referrer_id FROM users WHERE id = $2
+			UNION
+			SELECT u.id, u.referrer_id
+			FROM users u
+			INNER JOIN chain c ON u.id = c.referrer_id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $1);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("referrer_id", referrerID))
+
+	var found bool
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, userID, referrerID).Scan(&found)
+	if err != nil {
+		repo.log.Error("Failed to walk referral chain", slog.String("error", err.Error()))
+		return false, err
+	}
+	return found, nil
+}
+
+// leaderboardSource returns the FROM clause ranked by the leaderboard
+// queries, appending its arguments to args. Without since it is the lifetime
+// balance; otherwise the points earned from since on, summed from
+// points_daily. Either way it exposes lb.id and lb.points joined to users u,
+// leaving out users who opted out of the leaderboard.
+func leaderboardSource(since *time.Time, args []any) (string, []any) {
+	if since == nil {
+		return "(SELECT id, points FROM users WHERE NOT hide_from_leaderboard) lb INNER JOIN users u ON u.id = lb.id", args
+	}
+	args = append(args, *since)
+	return fmt.Sprintf(`(
+			SELECT user_id AS id, SUM(points)::int AS points
+			FROM points_daily
+			WHERE day >= $%d::date
+			GROUP BY user_id
+		) lb INNER JOIN users u ON u.id = lb.id AND NOT u.hide_from_leaderboard`, len(args)), args
+}
+
+// GetLeaderboard returns a page of users ordered by points and id. With a
+// cursor the page starts right after it and offset is ignored.
+func (repo *userRepository) GetLeaderboard(ctx context.Context, since *time.Time, cursor *models.LeaderboardCursor, offset int, limit int) ([]models.User, error) {
+	from, args := leaderboardSource(since, nil)
+
+	var query string
+	if cursor != nil {
+		args = append(args, cursor.Points, cursor.ID, limit)
+		query = fmt.Sprintf(`
+		SELECT lb.id, u.email, u.display_name, u.avatar_url, lb.points
+		FROM %s
+		WHERE lb.points < $%d OR (lb.points = $%d AND lb.id > $%d)
+		ORDER BY lb.points DESC, lb.id
+		LIMIT $%d;
+		`, from, len(args)-2, len(args)-2, len(args)-1, len(args))
+	} else {
+		args = append(args, limit, offset)
+		query = fmt.Sprintf(`
+		SELECT lb.id, u.email, u.display_name, u.avatar_url, lb.points
+		FROM %s
+		ORDER BY lb.points DESC, lb.id
+		LIMIT $%d OFFSET $%d;
+		`, from, len(args)-1, len(args))
+	}
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, args...)
+	if err != nil {
+		repo.log.Error("Failed to get leaderboard", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return repo.scanLeaderboard(rows)
+}
+
+// GetLeaderboardBefore returns up to limit users ranked right above the
+// cursor, highest ranked first.
+func (repo *userRepository) GetLeaderboardBefore(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor, limit int) ([]models.User, error) {
+	from, args := leaderboardSource(since, nil)
+	args = append(args, cursor.Points, cursor.ID, limit)
+
+	query := fmt.Sprintf(`
+	SELECT id, email, display_name, avatar_url, points
+	FROM (
+		SELECT lb.id, u.email, u.display_name, u.avatar_url, lb.points
+		FROM %s
+		WHERE lb.points > $%d OR (lb.points = $%d AND lb.id < $%d)
+		ORDER BY lb.points, lb.id DESC
+		LIMIT $%d
+	) above
+	ORDER BY points DESC, id;
+	`, from, len(args)-2, len(args)-2, len(args)-1, len(args))
+
 	repo.log.Debug("Executing query", slog.String("query", query))
 
-	rows, err := repo.pool.Query(ctx, query, limit)
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, args...)
 	if err != nil {
 		repo.log.Error("Failed to get leaderboard", slog.String("error", err.Error()))
 		return nil, err
 	}
+	return repo.scanLeaderboard(rows)
+}
+
+// CountRankedAhead returns the number of users ranked above the cursor and
+// the number of users on the leaderboard.
+func (repo *userRepository) CountRankedAhead(ctx context.Context, since *time.Time, cursor models.LeaderboardCursor) (int, int, error) {
+	from, args := leaderboardSource(since, nil)
+	args = append(args, cursor.Points, cursor.ID)
+
+	query := fmt.Sprintf(`
+	SELECT
+		COUNT(*) FILTER (WHERE lb.points > $%d OR (lb.points = $%d AND lb.id < $%d)),
+		COUNT(*)
+	FROM %s;
+	`, len(args)-1, len(args)-1, len(args), from)
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	var ahead, total int
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, args...).Scan(&ahead, &total)
+	if err != nil {
+		repo.log.Error("Failed to count rank", slog.String("error", err.Error()))
+		return 0, 0, err
+	}
+	return ahead, total, nil
+}
+
+// GetPeriodPoints returns the points the user earned from since on and
+// whether the user earned or lost anything in that time at all.
+func (repo *userRepository) GetPeriodPoints(ctx context.Context, userID int, since time.Time) (int, bool, error) {
+	query := `
+	SELECT COALESCE(SUM(points), 0)::int, COUNT(*) > 0
+	FROM points_daily
+	WHERE user_id = $1 AND day >= $2::date;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	var (
+		points int
+		active bool
+	)
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, userID, since).Scan(&points, &active)
+	if err != nil {
+		repo.log.Error("Failed to get period points", slog.String("error", err.Error()))
+		return 0, false, err
+	}
+	return points, active, nil
+}
+
+// ListLeaderboardPositions returns the lifetime balance of every user on the
+// leaderboard, which is what the leaderboard cache is rebuilt from.
+func (repo *userRepository) ListLeaderboardPositions(ctx context.Context) ([]models.LeaderboardCursor, error) {
+	query := `
+	SELECT points, id
+	FROM users
+	WHERE NOT hide_from_leaderboard;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query)
+	if err != nil {
+		repo.log.Error("Failed to list leaderboard positions", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	positions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.LeaderboardCursor])
+	if err != nil {
+		repo.log.Error("Failed to scan leaderboard positions", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed to scan leaderboard positions: %w", err)
+	}
+	return positions, nil
+}
+
+// GetLeaderboardUsers returns the leaderboard columns of the given users in
+// no particular order. Unknown and hidden users are skipped.
+func (repo *userRepository) GetLeaderboardUsers(ctx context.Context, ids []int) ([]models.User, error) {
+	query := `
+	SELECT id, email, display_name, avatar_url, points
+	FROM users
+	WHERE id = ANY($1) AND NOT hide_from_leaderboard;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("count", len(ids)))
+
+	rows, err := store.Conn(ctx, repo.pool).Query(ctx, query, ids)
+	if err != nil {
+		repo.log.Error("Failed to get leaderboard users", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return repo.scanLeaderboard(rows)
+}
+
+func (repo *userRepository) scanLeaderboard(rows pgx.Rows) ([]models.User, error) {
 	defer rows.Close()
 
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Email, &user.ReferrerID, &user.Points, &user.CreatedAt)
+		err := rows.Scan(&user.ID, &user.Email, &user.DisplayName, &user.AvatarURL, &user.Points)
 		if err != nil {
 			repo.log.Error("Failed to scan user", slog.String("error", err.Error()))
 			return nil, fmt.Errorf("failed to scan user: %w", err)
@@ -140,20 +563,45 @@ func (repo *userRepository) GetLeaderboard(ctx context.Context, limit int) ([]mo
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
-func (repo *userRepository) AddPoints(ctx context.Context, userID int, points int) error {
+// AddPoints writes a ledger entry, adds it to the user's total for the day
+// in points_daily and updates the cached balance, all in one statement.
+func (repo *userRepository) AddPoints(ctx context.Context, entry *models.PointTransaction) error {
+	// The daily row is written from the updated user row, so the user row is
+	// always locked first. ReconcilePoints takes the same locks in the same
+	// order. created_at is a TIMESTAMP in the session time zone, so the day
+	// is cut in UTC explicitly to line up with models.Period.
 	query := `
-        UPDATE users
-        SET points = points + $1
-        WHERE id = $2;
-    `
+		WITH entry AS (
+			INSERT INTO point_transactions (user_id, delta, reason, task_id, source_user_id)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING user_id, delta, created_at
+		), balance AS (
+			UPDATE users u
+			SET points = u.points + entry.delta
+			FROM entry
+			WHERE u.id = entry.user_id
+			RETURNING u.id
+		)
+		INSERT INTO points_daily (user_id, day, points)
+		SELECT entry.user_id, (entry.created_at::timestamptz AT TIME ZONE 'UTC')::date, entry.delta
+		FROM entry
+		INNER JOIN balance ON balance.id = entry.user_id
+		ON CONFLICT (user_id, day) DO UPDATE SET points = points_daily.points + EXCLUDED.points;
+	`
 
-	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("points", points))
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", entry.UserID), slog.Int("delta", entry.Delta), slog.String("reason", entry.Reason))
 
-	cmdTag, err := repo.pool.Exec(ctx, query, points, userID)
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, entry.UserID, entry.Delta, entry.Reason, entry.TaskID, entry.SourceUserID)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23503" && (pgErr.ConstraintName == "point_transactions_user_id_fkey" || pgErr.ConstraintName == "points_daily_user_id_fkey") {
+				return storeerrors.ErrUserNotFound
+			}
+		}
 		repo.log.Error("Failed to add points", slog.String("error", err.Error()))
 		return err
 	}
@@ -164,3 +612,232 @@ func (repo *userRepository) AddPoints(ctx context.Context, userID int, points in
 
 	return nil
 }
+
+// ReconcilePoints recomputes the user's balance and daily totals from the
+// ledger and returns the correction applied to the balance. The user row is
+// locked before the ledger is summed, so entries added concurrently are
+// either in the sum or applied on top of the corrected balance. It must run
+// inside a transaction.
+func (repo *userRepository) ReconcilePoints(ctx context.Context, userID int) (int, error) {
+	conn := store.Conn(ctx, repo.pool)
+
+	query := `
+		SELECT points
+		FROM users
+		WHERE id = $1
+		FOR UPDATE;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	var points int
+	err := conn.QueryRow(ctx, query, userID).Scan(&points)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, storeerrors.ErrUserNotFound
+		}
+		repo.log.Error("Failed to lock user balance", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	query = `
+		SELECT COALESCE(SUM(delta), 0)::int
+		FROM point_transactions
+		WHERE user_id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	var balance int
+	err = conn.QueryRow(ctx, query, userID).Scan(&balance)
+	if err != nil {
+		repo.log.Error("Failed to sum ledger", slog.String("error", err.Error()))
+		return 0, err
+	}
+	if balance == points {
+		return 0, nil
+	}
+
+	query = `
+		UPDATE users
+		SET points = $2
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.Int("points", balance))
+
+	_, err = conn.Exec(ctx, query, userID, balance)
+	if err != nil {
+		repo.log.Error("Failed to correct balance", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	query = `
+		DELETE FROM points_daily
+		WHERE user_id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	_, err = conn.Exec(ctx, query, userID)
+	if err != nil {
+		repo.log.Error("Failed to clear daily points", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	query = `
+		INSERT INTO points_daily (user_id, day, points)
+		SELECT user_id, (created_at::timestamptz AT TIME ZONE 'UTC')::date, SUM(delta)
+		FROM point_transactions
+		WHERE user_id = $1 AND reason <> $2
+		GROUP BY user_id, (created_at::timestamptz AT TIME ZONE 'UTC')::date;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	_, err = conn.Exec(ctx, query, userID, models.ReasonOpeningBalance)
+	if err != nil {
+		repo.log.Error("Failed to rebuild daily points", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	return balance - points, nil
+}
+
+// UpdateProfile stores the user's profile settings and refreshes user.Points
+// from the updated row.
+func (repo *userRepository) UpdateProfile(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET display_name = $2, avatar_url = $3, hide_from_leaderboard = $4, locale = $5, timezone = $6
+		WHERE id = $1
+		RETURNING points;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", user.ID))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, user.ID, user.DisplayName, user.AvatarURL, user.HideFromLeaderboard, user.Locale, user.Timezone).Scan(&user.Points)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storeerrors.ErrUserNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return storeerrors.ErrDisplayNameTaken
+		}
+		repo.log.Error("Failed to update profile", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *userRepository) SetPassword(ctx context.Context, userID int, password []byte) error {
+	query := `
+		UPDATE users
+		SET hash_password = $2
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, userID, password)
+	if err != nil {
+		repo.log.Error("Failed to set password", slog.String("error", err.Error()))
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrUserNotFound
+	}
+	return nil
+}
+
+// SetVerifiedEmail sets the user's email to an address they proved they
+// control.
+func (repo *userRepository) SetVerifiedEmail(ctx context.Context, userID int, email string) error {
+	query := `
+		UPDATE users
+		SET email = $2, email_verified = TRUE
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, userID, email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return storeerrors.ErrUserExists
+		}
+		repo.log.Error("Failed to set email", slog.String("error", err.Error()))
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrUserNotFound
+	}
+	return nil
+}
+
+func (repo *userRepository) SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error {
+	query := `
+		UPDATE users
+		SET tokens_valid_after = $1
+		WHERE id = $2;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, validAfter, userID)
+	if err != nil {
+		repo.log.Error("Failed to set tokens watermark", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (repo *userRepository) GetTokensValidAfter(ctx context.Context, userID int) (*time.Time, error) {
+	query := `
+		SELECT tokens_valid_after
+		FROM users
+		WHERE id = $1;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID))
+
+	var validAfter *time.Time
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, userID).Scan(&validAfter)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storeerrors.ErrUserNotFound
+		}
+		repo.log.Error("Failed to get tokens watermark", slog.String("error", err.Error()))
+		return nil, err
+	}
+	return validAfter, nil
+}
+
+func (repo *userRepository) SetRole(ctx context.Context, userID int, role models.Role) error {
+	query := `
+		UPDATE users
+		SET role = $1
+		WHERE id = $2;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.Int("user_id", userID), slog.String("role", string(role)))
+
+	cmdTag, err := store.Conn(ctx, repo.pool).Exec(ctx, query, role, userID)
+	if err != nil {
+		repo.log.Error("Failed to set role", slog.String("error", err.Error()))
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return storeerrors.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package userrepo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// benchmarkUsers matches the size of the in-memory store benchmarks in
+// internal/leaderboard, so the two can be compared directly.
+const benchmarkUsers = 100_000
+
+var errRollback = errors.New("rollback")
+
+// withSeededUsers runs fn in a transaction holding benchmarkUsers extra
+// users and rolls it back afterwards. It needs a migrated database in
+// TEST_DATABASE_URL.
+func withSeededUsers(b *testing.B, fn func(ctx context.Context, repo repository.UserRepository)) {
+	b.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		b.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		b.Fatalf("failed to connect: %v", err)
+	}
+	defer pool.Close()
+
+	repo := NewUserRepository(pool, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err = store.NewTxManager(pool).WithinTx(context.Background(), func(ctx context.Context) error {
+		_, err := store.Conn(ctx, pool).Exec(ctx, `
+			INSERT INTO users (email, hash_password, referral_code, points)
+			SELECT 'bench' || g || '@example.com', 'x', 'BENCH' || g, (random() * 10000)::int
+			FROM generate_series(1, $1) AS g;
+		`, benchmarkUsers)
+		if err != nil {
+			return err
+		}
+		_, err = store.Conn(ctx, pool).Exec(ctx, "ANALYZE users")
+		if err != nil {
+			return err
+		}
+
+		b.ResetTimer()
+		fn(ctx, repo)
+		b.StopTimer()
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		b.Fatalf("failed to seed users: %v", err)
+	}
+}
+
+func BenchmarkGetLeaderboard(b *testing.B) {
+	withSeededUsers(b, func(ctx context.Context, repo repository.UserRepository) {
+		for i := 0; i < b.N; i++ {
+			_, err := repo.GetLeaderboard(ctx, nil, nil, (i*997)%benchmarkUsers, 100)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCountRankedAhead(b *testing.B) {
+	withSeededUsers(b, func(ctx context.Context, repo repository.UserRepository) {
+		for i := 0; i < b.N; i++ {
+			_, _, err := repo.CountRankedAhead(ctx, nil, models.LeaderboardCursor{Points: i % 10_000, ID: i % benchmarkUsers})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
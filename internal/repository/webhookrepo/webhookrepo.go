@@ -0,0 +1,103 @@
+package webhookrepo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	"github.com/dorik33/DeNet/internal/repository/store"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type webhookRepository struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool, log *slog.Logger) repository.WebhookRepository {
+	return &webhookRepository{
+		pool: pool,
+		log:  log,
+	}
+}
+
+// LinkAccount maps the user's account on a partner site to userID. Each
+// external account and each user can be linked only once per provider.
+func (repo *webhookRepository) LinkAccount(ctx context.Context, provider string, externalID string, userID int) error {
+	query := `
+		INSERT INTO external_accounts (provider, external_id, user_id)
+		VALUES ($1, $2, $3);
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("provider", provider), slog.Int("user_id", userID))
+
+	_, err := store.Conn(ctx, repo.pool).Exec(ctx, query, provider, externalID, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storeerrors.ErrAccountLinked
+			}
+			if pgErr.Code == "23503" {
+				return storeerrors.ErrUserNotFound
+			}
+		}
+		repo.log.Error("Failed to link account", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (repo *webhookRepository) GetLinkedUserID(ctx context.Context, provider string, externalID string) (int, error) {
+	query := `
+		SELECT user_id
+		FROM external_accounts
+		WHERE provider = $1 AND external_id = $2;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("provider", provider))
+
+	var userID int
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, provider, externalID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, storeerrors.ErrUserNotFound
+		}
+		repo.log.Error("Failed to get linked user", slog.String("error", err.Error()))
+		return 0, err
+	}
+	return userID, nil
+}
+
+// RecordEvent stores a delivered event. It returns ErrEventExists when the
+// provider already sent an event with the same id.
+func (repo *webhookRepository) RecordEvent(ctx context.Context, event *models.WebhookEvent) error {
+	query := `
+		INSERT INTO webhook_events (provider, event_id, user_id, task_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING received_at;
+	`
+
+	repo.log.Debug("Executing query", slog.String("query", query), slog.String("provider", event.Provider), slog.String("event_id", event.EventID))
+
+	err := store.Conn(ctx, repo.pool).QueryRow(ctx, query, event.Provider, event.EventID, event.UserID, event.TaskID).Scan(&event.ReceivedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storeerrors.ErrEventExists
+			}
+			if pgErr.Code == "23503" {
+				return storeerrors.ErrTaskNotFound
+			}
+		}
+		repo.log.Error("Failed to record webhook event", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
@@ -7,10 +7,49 @@ import (
 )
 
 type UserService interface {
-	Register(ctx context.Context, email string, password string) error
-	Login(ctx context.Context, email string, password string) (string, error)
-	GetLeaderboard(ctx context.Context, limit int) ([]models.User, error)
-	SetReferrer(ctx context.Context, userID int, referrerID int) error
+	Register(ctx context.Context, email string, password string, referralCode string) error
+	Login(ctx context.Context, email string, password string) (*models.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	GetLeaderboard(ctx context.Context, query models.LeaderboardQuery) (*models.LeaderboardPage, error)
+	GetRank(ctx context.Context, userID int, period models.Period) (*models.UserRank, error)
+	GetLeaderboardAround(ctx context.Context, userID int, n int, period models.Period) (*models.LeaderboardAround, error)
+	SetReferrer(ctx context.Context, userID int, referralCode string) error
+	SetReferralCode(ctx context.Context, userID int, code string) (string, error)
+	GetProfile(ctx context.Context, userID int) (*models.Profile, error)
+	UpdateProfile(ctx context.Context, userID int, req models.UpdateProfileRequest) (*models.Profile, error)
+	ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string) (*models.TokenPair, error)
+	RequestEmailChange(ctx context.Context, userID int, email string, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, userID int) error
+	GetReferrals(ctx context.Context, userID int, depth int) (*models.ReferralTree, error)
+	GetReferralStats(ctx context.Context, userID int, days int) (*models.ReferralStats, error)
 	Status(ctx context.Context, ID int) (*models.UserStatus, error)
-	CompleteTask(ctx context.Context, userID int, taskID int) error
+	CompleteTask(ctx context.Context, userID int, taskID int, proof *models.TaskProof) (*models.Submission, error)
+	ConfirmTask(ctx context.Context, provider string, userID int, taskID int) (*models.Submission, error)
+	ListSubmissions(ctx context.Context, status models.SubmissionStatus, limit int, offset int) (*models.SubmissionsPage, error)
+	ReviewSubmission(ctx context.Context, moderatorID int, submissionID int64, approve bool, comment string) (*models.Submission, error)
+	GetTransactions(ctx context.Context, userID int, cursor int64, limit int) (*models.TransactionsPage, error)
+	ReconcilePoints(ctx context.Context) (int64, error)
+	SetRole(ctx context.Context, userID int, role models.Role) error
+}
+
+type WebhookService interface {
+	VerifySignature(provider string, timestamp string, signature string, body []byte) error
+	ConfirmTask(ctx context.Context, provider string, req models.WebhookTaskRequest) (*models.WebhookEvent, error)
+	IssueLinkToken(ctx context.Context, userID int, provider string) (*models.LinkToken, error)
+	LinkAccount(ctx context.Context, provider string, req models.WebhookAccountRequest) error
+}
+
+type SessionService interface {
+	Logout(ctx context.Context, claims *models.UserClaims, refreshToken string) error
+	RevokeAll(ctx context.Context, userID int) error
+	IsRevoked(ctx context.Context, claims *models.UserClaims) (bool, error)
+}
+
+type TaskService interface {
+	ListTasks(ctx context.Context, filter models.TaskFilter) (*models.TasksPage, error)
+	ListUserTasks(ctx context.Context, userID int, filter models.TaskFilter) (*models.TaskProgressPage, error)
+	CreateTask(ctx context.Context, req models.TaskRequest) (*models.Task, error)
+	UpdateTask(ctx context.Context, id int, req models.TaskRequest) (*models.Task, error)
+	DeleteTask(ctx context.Context, id int) error
 }
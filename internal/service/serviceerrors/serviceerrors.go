@@ -1,11 +1,69 @@
 package serviceerrors
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
-	ErrUserAlreadyExists = errors.New("user already exists")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrTaskNotFound      = errors.New("task not found")
-	ErrTaskAlreadyDone   = errors.New("task already completed")
-	ErrInvalidPassword   = errors.New("invalid password")
+	ErrUserAlreadyExists  = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrTaskAlreadyDone    = errors.New("task already completed")
+	ErrTaskCooldown       = errors.New("task on cooldown")
+	ErrTaskArchived       = errors.New("task archived")
+	ErrTaskNotStarted     = errors.New("task not started")
+	ErrTaskEnded          = errors.New("task ended")
+	ErrTaskCapReached     = errors.New("task completion cap reached")
+	ErrTaskLocked         = errors.New("task locked")
+	ErrPrerequisiteCycle  = errors.New("prerequisite cycle")
+	ErrUnknownPrereq      = errors.New("unknown prerequisite")
+	ErrTaskExists         = errors.New("task already exists")
+	ErrInvalidTask        = errors.New("invalid task")
+	ErrInvalidFilter      = errors.New("invalid filter")
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrInvalidToken       = errors.New("invalid refresh token")
+	ErrTokenReused        = errors.New("refresh token reused")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrProofRequired      = errors.New("proof required")
+	ErrInvalidProof       = errors.New("invalid proof")
+	ErrSubmissionNotFound = errors.New("submission not found")
+	ErrSelfReview         = errors.New("cannot review own submission")
+	ErrPartnerOnly        = errors.New("task is confirmed by partner")
+	ErrUnknownProvider    = errors.New("unknown provider")
+	ErrAccountLinked      = errors.New("account already linked")
+	ErrEventProcessed     = errors.New("event already processed")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrInvalidEvent       = errors.New("invalid event")
+	ErrInvalidAccount     = errors.New("invalid external account")
+	ErrInvalidLinkToken   = errors.New("invalid link token")
+	ErrLinkTokenExpired   = errors.New("link token expired")
+	ErrReferralCodeTaken  = errors.New("referral code taken")
+	ErrInvalidCode        = errors.New("invalid referral code")
+	ErrReferrerNotFound   = errors.New("referrer not found")
+	ErrReferrerAlreadySet = errors.New("referrer already set")
+	ErrSelfReferral       = errors.New("self referral")
+	ErrReferralCycle      = errors.New("referral cycle")
+	ErrReferrerTooNew     = errors.New("referrer registered after referee")
+	ErrInvalidProfile     = errors.New("invalid profile")
+	ErrDisplayNameTaken   = errors.New("display name taken")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidVerifyToken = errors.New("invalid verification token")
+	ErrVerifyTokenExpired = errors.New("verification token expired")
+	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrAlreadyVerified    = errors.New("email already verified")
 )
+
+// CooldownError is returned when a repeatable task is completed again before
+// its cooldown has elapsed. It matches ErrTaskCooldown.
+type CooldownError struct {
+	RetryAfter time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return "task on cooldown until " + e.RetryAfter.Format(time.RFC3339)
+}
+
+func (e *CooldownError) Is(target error) bool {
+	return target == ErrTaskCooldown
+}
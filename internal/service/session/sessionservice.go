@@ -0,0 +1,214 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/dorik33/DeNet/internal/service"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/utills"
+)
+
+type watermark struct {
+	validAfter time.Time
+	fetchedAt  time.Time
+}
+
+// sessionService keeps revocation state in Postgres and caches it in process.
+// Revocations made through this instance are visible immediately; the ones
+// made by other instances are picked up once the cached entry is older than
+// cfg.RevocationTTL.
+type sessionService struct {
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
+	log       *slog.Logger
+	cfg       *config.Config
+
+	mu         sync.Mutex
+	revoked    map[string]time.Time // jti -> token expiry
+	notRevoked map[string]time.Time // jti -> time of the last check
+	watermarks map[int]watermark
+	lastSweep  time.Time
+}
+
+func NewSessionService(
+	userRepo repository.UserRepository,
+	tokenRepo repository.TokenRepository,
+	log *slog.Logger,
+	cfg *config.Config,
+) service.SessionService {
+	return &sessionService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		log:        log,
+		cfg:        cfg,
+		revoked:    make(map[string]time.Time),
+		notRevoked: make(map[string]time.Time),
+		watermarks: make(map[int]watermark),
+		lastSweep:  time.Now(),
+	}
+}
+
+func (service *sessionService) Logout(ctx context.Context, claims *models.UserClaims, refreshToken string) error {
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("invalid claims: %w", err)
+	}
+	expiresAt := claims.ExpiresAt.Time.UTC()
+
+	err = service.tokenRepo.RevokeAccessToken(ctx, claims.ID, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	service.mu.Lock()
+	service.revoked[claims.ID] = expiresAt
+	delete(service.notRevoked, claims.ID)
+	service.mu.Unlock()
+
+	if refreshToken != "" {
+		stored, err := service.tokenRepo.GetRefreshTokenByHash(ctx, utills.HashToken(refreshToken))
+		if err != nil && !errors.Is(err, storeerrors.ErrTokenNotFound) {
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+		if err == nil && stored.UserID == userID {
+			err = service.tokenRepo.RevokeRefreshFamily(ctx, stored.FamilyID)
+			if err != nil {
+				return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+			}
+		}
+	}
+
+	service.log.Info("User successfully logged out", slog.Int("userID", userID))
+	return nil
+}
+
+func (service *sessionService) RevokeAll(ctx context.Context, userID int) error {
+	now := utills.TokenWatermark(time.Now())
+
+	err := service.userRepo.SetTokensValidAfter(ctx, userID, now)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to set tokens watermark: %w", err)
+	}
+
+	err = service.tokenRepo.RevokeUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	service.mu.Lock()
+	service.watermarks[userID] = watermark{validAfter: now, fetchedAt: time.Now()}
+	service.mu.Unlock()
+
+	service.log.Info("All user sessions revoked", slog.Int("userID", userID))
+	return nil
+}
+
+func (service *sessionService) IsRevoked(ctx context.Context, claims *models.UserClaims) (bool, error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return true, nil
+	}
+
+	validAfter, err := service.tokensValidAfter(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if claims.IssuedAt.Time.Before(validAfter) {
+		return true, nil
+	}
+
+	now := time.Now()
+	service.mu.Lock()
+	service.sweep(now)
+	if _, ok := service.revoked[claims.ID]; ok {
+		service.mu.Unlock()
+		return true, nil
+	}
+	checkedAt, ok := service.notRevoked[claims.ID]
+	service.mu.Unlock()
+	if ok && now.Sub(checkedAt) < service.cfg.RevocationTTL {
+		return false, nil
+	}
+
+	revoked, err := service.tokenRepo.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	service.mu.Lock()
+	if revoked {
+		service.revoked[claims.ID] = claims.ExpiresAt.Time
+	} else {
+		service.notRevoked[claims.ID] = now
+	}
+	service.mu.Unlock()
+
+	return revoked, nil
+}
+
+// tokensValidAfter returns the user's revoke-all watermark, or the zero time
+// when all sessions were never revoked.
+func (service *sessionService) tokensValidAfter(ctx context.Context, userID int) (time.Time, error) {
+	service.mu.Lock()
+	cached, ok := service.watermarks[userID]
+	service.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < service.cfg.RevocationTTL {
+		return cached.validAfter, nil
+	}
+
+	validAfter, err := service.userRepo.GetTokensValidAfter(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return time.Time{}, serviceerrors.ErrUserNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to get tokens watermark: %w", err)
+	}
+
+	entry := watermark{fetchedAt: time.Now()}
+	if validAfter != nil {
+		entry.validAfter = *validAfter
+	}
+
+	service.mu.Lock()
+	service.watermarks[userID] = entry
+	service.mu.Unlock()
+
+	return entry.validAfter, nil
+}
+
+// sweep drops cache entries that can no longer affect a decision. It must be
+// called with mu held.
+func (service *sessionService) sweep(now time.Time) {
+	if now.Sub(service.lastSweep) < service.cfg.RevocationTTL {
+		return
+	}
+	service.lastSweep = now
+
+	for jti, expiresAt := range service.revoked {
+		if now.After(expiresAt) {
+			delete(service.revoked, jti)
+		}
+	}
+	for jti, checkedAt := range service.notRevoked {
+		if now.Sub(checkedAt) >= service.cfg.RevocationTTL {
+			delete(service.notRevoked, jti)
+		}
+	}
+	for userID, entry := range service.watermarks {
+		if now.Sub(entry.fetchedAt) >= service.cfg.RevocationTTL {
+			delete(service.watermarks, userID)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/dorik33/DeNet/internal/service"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+)
+
+type taskService struct {
+	taskRepo  repository.TaskRepository
+	txManager repository.TxManager
+	log       *slog.Logger
+}
+
+func NewTaskService(taskRepo repository.TaskRepository, txManager repository.TxManager, log *slog.Logger) service.TaskService {
+	return &taskService{
+		taskRepo:  taskRepo,
+		txManager: txManager,
+		log:       log,
+	}
+}
+
+func (service *taskService) ListTasks(ctx context.Context, filter models.TaskFilter) (*models.TasksPage, error) {
+	tasks, total, err := service.taskRepo.ListTasks(ctx, filter)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrInvalidSort) {
+			return nil, serviceerrors.ErrInvalidFilter
+		}
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+
+	now := time.Now()
+	for i := range tasks {
+		tasks[i].CurrentReward = tasks[i].RewardAt(now)
+	}
+
+	service.log.Info("Tasks successfully listed")
+	return &models.TasksPage{
+		Tasks:  tasks,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+func (service *taskService) ListUserTasks(ctx context.Context, userID int, filter models.TaskFilter) (*models.TaskProgressPage, error) {
+	tasks, total, err := service.taskRepo.ListUserTasks(ctx, userID, filter)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrInvalidSort) {
+			return nil, serviceerrors.ErrInvalidFilter
+		}
+		return nil, fmt.Errorf("failed to list user tasks: %w", err)
+	}
+	if tasks == nil {
+		tasks = []models.TaskProgress{}
+	}
+
+	now := time.Now()
+	for i := range tasks {
+		tasks[i].CurrentReward = tasks[i].RewardAt(now)
+		tasks[i].State = models.TaskStateAvailable
+		next, ok := tasks[i].NextCompletionAt(tasks[i].Completions, tasks[i].CompletedAt)
+		switch {
+		case tasks[i].Pending:
+			tasks[i].State = models.TaskStatePending
+		case !ok:
+			tasks[i].State = models.TaskStateCompleted
+		case now.Before(next):
+			tasks[i].State = models.TaskStateCompleted
+			tasks[i].AvailableAt = &next
+		case tasks[i].Locked:
+			tasks[i].State = models.TaskStateLocked
+		}
+	}
+
+	service.log.Info("User tasks successfully listed", slog.Int("userID", userID))
+	return &models.TaskProgressPage{
+		Tasks:  tasks,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+func (service *taskService) CreateTask(ctx context.Context, req models.TaskRequest) (*models.Task, error) {
+	task, err := taskFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		err := service.taskRepo.CreateTask(ctx, task)
+		if err != nil {
+			return fmt.Errorf("failed to create task: %w", err)
+		}
+		return service.setPrerequisites(ctx, task)
+	})
+	if err != nil {
+		return nil, mapTaskError(err)
+	}
+
+	service.log.Info("Task successfully created", slog.Int("taskID", task.ID))
+	return task, nil
+}
+
+func (service *taskService) UpdateTask(ctx context.Context, id int, req models.TaskRequest) (*models.Task, error) {
+	task, err := taskFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	task.ID = id
+
+	err = service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		err := service.taskRepo.UpdateTask(ctx, task)
+		if err != nil {
+			return fmt.Errorf("failed to update task: %w", err)
+		}
+		return service.setPrerequisites(ctx, task)
+	})
+	if err != nil {
+		return nil, mapTaskError(err)
+	}
+
+	service.log.Info("Task successfully updated", slog.Int("taskID", task.ID))
+	return task, nil
+}
+
+func (service *taskService) DeleteTask(ctx context.Context, id int) error {
+	err := service.taskRepo.ArchiveTask(ctx, id)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrTaskNotFound) {
+			return serviceerrors.ErrTaskNotFound
+		}
+		return fmt.Errorf("failed to archive task: %w", err)
+	}
+
+	service.log.Info("Task successfully archived", slog.Int("taskID", id))
+	return nil
+}
+
+// setPrerequisites stores the task's prerequisites and rejects the change if
+// it would make the task depend on itself.
+func (service *taskService) setPrerequisites(ctx context.Context, task *models.Task) error {
+	err := service.taskRepo.SetPrerequisites(ctx, task.ID, task.Prerequisites)
+	if err != nil {
+		return fmt.Errorf("failed to set prerequisites: %w", err)
+	}
+
+	cycle, err := service.taskRepo.HasPrerequisiteCycle(ctx, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check prerequisites: %w", err)
+	}
+	if cycle {
+		return serviceerrors.ErrPrerequisiteCycle
+	}
+	return nil
+}
+
+func mapTaskError(err error) error {
+	switch {
+	case errors.Is(err, storeerrors.ErrTaskNotFound):
+		return serviceerrors.ErrTaskNotFound
+	case errors.Is(err, storeerrors.ErrTaskExists):
+		return serviceerrors.ErrTaskExists
+	case errors.Is(err, storeerrors.ErrUnknownPrereq):
+		return serviceerrors.ErrUnknownPrereq
+	case errors.Is(err, storeerrors.ErrPrerequisiteCycle):
+		return serviceerrors.ErrPrerequisiteCycle
+	}
+	return err
+}
+
+func taskFromRequest(req models.TaskRequest) (*models.Task, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || req.Reward < 0 {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+
+	if req.Recurrence == "" {
+		req.Recurrence = models.RecurrenceOnce
+	}
+	if !req.Recurrence.Valid() {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if (req.Recurrence == models.RecurrenceInterval) != (req.IntervalHours != nil) {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.IntervalHours != nil && *req.IntervalHours <= 0 {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.MaxCompletions != nil && *req.MaxCompletions <= 0 {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.MinPoints < 0 {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.Verification == "" {
+		req.Verification = models.VerificationAuto
+	}
+	if !req.Verification.Valid() {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if (req.Verification == models.VerificationWebhook) != (req.Provider != nil) {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.Provider != nil && *req.Provider == "" {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.Prerequisites == nil {
+		req.Prerequisites = []int{}
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.CompletionCap != nil && *req.CompletionCap <= 0 {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+	if req.RewardDecayPerDay < 0 || req.MinReward < 0 || req.MinReward > req.Reward {
+		return nil, serviceerrors.ErrInvalidTask
+	}
+
+	return &models.Task{
+		Name:           name,
+		Description:    strings.TrimSpace(req.Description),
+		Reward:         req.Reward,
+		Recurrence:     req.Recurrence,
+		IntervalHours:  req.IntervalHours,
+		MaxCompletions: req.MaxCompletions,
+		MinPoints:      req.MinPoints,
+		Prerequisites:  req.Prerequisites,
+		Verification:   req.Verification,
+		Provider:       req.Provider,
+
+		StartsAt:          utcTime(req.StartsAt),
+		EndsAt:            utcTime(req.EndsAt),
+		CompletionCap:     req.CompletionCap,
+		RewardDecayPerDay: req.RewardDecayPerDay,
+		MinReward:         req.MinReward,
+	}, nil
+}
+
+// utcTime converts client supplied times to UTC, which is what the
+// timestamp columns hold.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
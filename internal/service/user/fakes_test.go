@@ -0,0 +1,405 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/events"
+	"github.com/dorik33/DeNet/internal/mailer"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/dorik33/DeNet/internal/service"
+)
+
+// fakeDB is the state shared by the fake repositories. fakeTxManager copies
+// it when a transaction starts and puts the copy back on rollback.
+type fakeDB struct {
+	users         map[int]models.User
+	tasks         map[int]models.Task
+	submissions   []models.Submission
+	ledger        []models.PointTransaction
+	verifications []models.EmailVerification
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		users: make(map[int]models.User),
+		tasks: make(map[int]models.Task),
+	}
+}
+
+func (db *fakeDB) clone() *fakeDB {
+	return &fakeDB{
+		users:         maps.Clone(db.users),
+		tasks:         maps.Clone(db.tasks),
+		submissions:   slices.Clone(db.submissions),
+		ledger:        slices.Clone(db.ledger),
+		verifications: slices.Clone(db.verifications),
+	}
+}
+
+type fakeTxKey struct{}
+
+type fakeHooks struct {
+	fns []func()
+}
+
+type fakeTxManager struct {
+	db *fakeDB
+}
+
+func (m *fakeTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(fakeTxKey{}).(*fakeHooks); ok {
+		return fn(ctx)
+	}
+
+	snapshot := m.db.clone()
+	hooks := &fakeHooks{}
+	err := fn(context.WithValue(ctx, fakeTxKey{}, hooks))
+	if err != nil {
+		*m.db = *snapshot
+		return err
+	}
+
+	for _, hook := range hooks.fns {
+		hook()
+	}
+	return nil
+}
+
+func (m *fakeTxManager) AfterCommit(ctx context.Context, fn func()) {
+	if hooks, ok := ctx.Value(fakeTxKey{}).(*fakeHooks); ok {
+		hooks.fns = append(hooks.fns, fn)
+		return
+	}
+	fn()
+}
+
+// fakeUserRepo implements the UserRepository methods used by task
+// completion, review, referrals and email changes. Calling any other method
+// panics.
+type fakeUserRepo struct {
+	repository.UserRepository
+	db *fakeDB
+
+	addPointsErr error
+	chainErr     error
+}
+
+func (repo *fakeUserRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	user, ok := repo.db.users[id]
+	if !ok {
+		return nil, storeerrors.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (repo *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range repo.db.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, storeerrors.ErrUserNotFound
+}
+
+func (repo *fakeUserRepo) SetVerifiedEmail(ctx context.Context, userID int, email string) error {
+	user, ok := repo.db.users[userID]
+	if !ok {
+		return storeerrors.ErrUserNotFound
+	}
+	user.Email, user.EmailVerified = email, true
+	repo.db.users[userID] = user
+	return nil
+}
+
+func (repo *fakeUserRepo) AddPoints(ctx context.Context, entry *models.PointTransaction) error {
+	if repo.addPointsErr != nil {
+		return repo.addPointsErr
+	}
+	user, ok := repo.db.users[entry.UserID]
+	if !ok {
+		return storeerrors.ErrUserNotFound
+	}
+	user.Points += entry.Delta
+	repo.db.users[entry.UserID] = user
+	repo.db.ledger = append(repo.db.ledger, *entry)
+	return nil
+}
+
+func (repo *fakeUserRepo) GetReferrerChain(ctx context.Context, userID int, depth int) ([]models.User, error) {
+	if repo.chainErr != nil {
+		return nil, repo.chainErr
+	}
+	var chain []models.User
+	for user := repo.db.users[userID]; user.ReferrerID != nil && len(chain) < depth; {
+		user = repo.db.users[*user.ReferrerID]
+		chain = append(chain, user)
+	}
+	return chain, nil
+}
+
+func (repo *fakeUserRepo) GetUserByReferralCode(ctx context.Context, code string) (*models.User, error) {
+	for _, user := range repo.db.users {
+		if user.ReferralCode == code {
+			return &user, nil
+		}
+	}
+	return nil, storeerrors.ErrUserNotFound
+}
+
+func (repo *fakeUserRepo) LockReferralGraph(ctx context.Context) error {
+	return nil
+}
+
+func (repo *fakeUserRepo) IsInReferralChain(ctx context.Context, userID int, referrerID int) (bool, error) {
+	for id, seen := referrerID, 0; seen <= len(repo.db.users); seen++ {
+		if id == userID {
+			return true, nil
+		}
+		next := repo.db.users[id].ReferrerID
+		if next == nil {
+			return false, nil
+		}
+		id = *next
+	}
+	return false, nil
+}
+
+func (repo *fakeUserRepo) SetReferrer(ctx context.Context, userID int, referrerID int) error {
+	user, ok := repo.db.users[userID]
+	if !ok {
+		return storeerrors.ErrUserNotFound
+	}
+	if user.ReferrerID != nil {
+		return storeerrors.ErrReferrerSet
+	}
+	user.ReferrerID = &referrerID
+	repo.db.users[userID] = user
+	return nil
+}
+
+// fakeTaskRepo implements the TaskRepository methods used by task
+// completion and review.
+type fakeTaskRepo struct {
+	repository.TaskRepository
+	db *fakeDB
+}
+
+func (repo *fakeTaskRepo) GetTaskByID(ctx context.Context, id int) (*models.Task, error) {
+	task, ok := repo.db.tasks[id]
+	if !ok {
+		return nil, storeerrors.ErrTaskNotFound
+	}
+	return &task, nil
+}
+
+func (repo *fakeTaskRepo) LockUserTask(ctx context.Context, userID int, taskID int) error {
+	return nil
+}
+
+func (repo *fakeTaskRepo) GetCompletionStats(ctx context.Context, userID int, taskID int) (int, *time.Time, error) {
+	var (
+		completions int
+		last        *time.Time
+	)
+	for _, submission := range repo.db.submissions {
+		if submission.UserID != userID || submission.TaskID != taskID || submission.Status == models.SubmissionRejected {
+			continue
+		}
+		completions++
+		last = &submission.CompletedAt
+	}
+	return completions, last, nil
+}
+
+func (repo *fakeTaskRepo) GetUnmetPrerequisites(ctx context.Context, userID int, taskID int) ([]int, error) {
+	return nil, nil
+}
+
+func (repo *fakeTaskRepo) ReserveCompletion(ctx context.Context, taskID int) error {
+	task := repo.db.tasks[taskID]
+	if task.CompletionCap != nil && task.CompletionCount >= *task.CompletionCap {
+		return storeerrors.ErrCapReached
+	}
+	task.CompletionCount++
+	repo.db.tasks[taskID] = task
+	return nil
+}
+
+func (repo *fakeTaskRepo) ReleaseCompletion(ctx context.Context, taskID int) error {
+	task := repo.db.tasks[taskID]
+	if task.CompletionCount > 0 {
+		task.CompletionCount--
+		repo.db.tasks[taskID] = task
+	}
+	return nil
+}
+
+func (repo *fakeTaskRepo) CompleteTask(ctx context.Context, submission *models.Submission) error {
+	submission.ID = int64(len(repo.db.submissions) + 1)
+	submission.CompletedAt = time.Now().UTC()
+	repo.db.submissions = append(repo.db.submissions, *submission)
+	return nil
+}
+
+func (repo *fakeTaskRepo) GetSubmission(ctx context.Context, id int64) (*models.Submission, error) {
+	for _, submission := range repo.db.submissions {
+		if submission.ID == id {
+			return &submission, nil
+		}
+	}
+	return nil, storeerrors.ErrSubmissionNotFound
+}
+
+func (repo *fakeTaskRepo) ReviewSubmission(ctx context.Context, submission *models.Submission) error {
+	for i := range repo.db.submissions {
+		if repo.db.submissions[i].ID == submission.ID {
+			repo.db.submissions[i] = *submission
+			return nil
+		}
+	}
+	return storeerrors.ErrSubmissionNotFound
+}
+
+// fakeTokenRepo implements the TokenRepository methods used by email
+// verification.
+type fakeTokenRepo struct {
+	repository.TokenRepository
+	db *fakeDB
+}
+
+func (repo *fakeTokenRepo) CreateEmailVerification(ctx context.Context, verification *models.EmailVerification) error {
+	verification.ID = int64(len(repo.db.verifications) + 1)
+	verification.CreatedAt = time.Now().UTC()
+	repo.db.verifications = append(repo.db.verifications, *verification)
+	return nil
+}
+
+func (repo *fakeTokenRepo) GetEmailVerification(ctx context.Context, id int64) (*models.EmailVerification, error) {
+	for _, verification := range repo.db.verifications {
+		if verification.ID == id {
+			return &verification, nil
+		}
+	}
+	return nil, storeerrors.ErrTokenNotFound
+}
+
+func (repo *fakeTokenRepo) MarkEmailVerificationUsed(ctx context.Context, id int64) error {
+	now := time.Now().UTC()
+	for i := range repo.db.verifications {
+		if repo.db.verifications[i].ID == id {
+			repo.db.verifications[i].UsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (repo *fakeTokenRepo) InvalidateEmailVerifications(ctx context.Context, userID int, exceptID int64) error {
+	now := time.Now().UTC()
+	for i, verification := range repo.db.verifications {
+		if verification.UserID == userID && verification.UsedAt == nil && verification.ID != exceptID {
+			repo.db.verifications[i].UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// fakeSessions counts RevokeAll calls per user.
+type fakeSessions struct {
+	service.SessionService
+	revoked map[int]int
+}
+
+func (s *fakeSessions) RevokeAll(ctx context.Context, userID int) error {
+	s.revoked[userID]++
+	return nil
+}
+
+// fakeMailer keeps every message it is asked to send.
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+type fakePublisher struct {
+	events []events.Event
+}
+
+func (p *fakePublisher) Publish(event events.Event) {
+	p.events = append(p.events, event)
+}
+
+var errFake = errors.New("fake failure")
+
+// testEnv is a user service over the fakes with one verified user and
+// referrer and one auto-verified task.
+type testEnv struct {
+	db        *fakeDB
+	userRepo  *fakeUserRepo
+	sessions  *fakeSessions
+	mailer    *fakeMailer
+	publisher *fakePublisher
+	service   service.UserService
+}
+
+const (
+	testReferrerID = 1
+	testUserID     = 2
+	testTaskID     = 10
+	testReward     = 100
+
+	testVerifyURL = "https://denet.local/verify-email?token="
+)
+
+func newTestEnv() *testEnv {
+	db := newFakeDB()
+	referrerID := testReferrerID
+	db.users[testReferrerID] = models.User{ID: testReferrerID, EmailVerified: true}
+	db.users[testUserID] = models.User{ID: testUserID, EmailVerified: true, ReferrerID: &referrerID}
+	db.tasks[testTaskID] = models.Task{
+		ID:           testTaskID,
+		Reward:       testReward,
+		Recurrence:   models.RecurrenceOnce,
+		Verification: models.VerificationAuto,
+	}
+
+	cfg := &config.Config{}
+	cfg.ReferralCfg.CommissionTiers = []int{10}
+	cfg.EmailCfg.TokenSecret = "email-secret"
+	cfg.EmailCfg.TokenTTL = time.Hour
+	cfg.EmailCfg.VerifyURL = testVerifyURL
+
+	env := &testEnv{
+		db:        db,
+		userRepo:  &fakeUserRepo{db: db},
+		sessions:  &fakeSessions{revoked: make(map[int]int)},
+		mailer:    &fakeMailer{},
+		publisher: &fakePublisher{},
+	}
+	env.service = NewUserService(
+		env.userRepo,
+		&fakeTaskRepo{db: db},
+		nil,
+		&fakeTokenRepo{db: db},
+		&fakeTxManager{db: db},
+		env.sessions,
+		env.publisher,
+		env.mailer,
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg,
+	)
+	return env
+}
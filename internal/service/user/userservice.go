@@ -5,107 +5,561 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/events"
+	"github.com/dorik33/DeNet/internal/mailer"
 	"github.com/dorik33/DeNet/internal/models"
 	"github.com/dorik33/DeNet/internal/repository"
 	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
 	"github.com/dorik33/DeNet/internal/service"
 	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/signing"
 	"github.com/dorik33/DeNet/internal/utills"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type userService struct {
-	userRepo repository.UserRepository
-	taskRepo repository.TaskRepository
-	log      *slog.Logger
-	cfg      *config.Config
+	userRepo   repository.UserRepository
+	taskRepo   repository.TaskRepository
+	ledgerRepo repository.LedgerRepository
+	tokenRepo  repository.TokenRepository
+	txManager  repository.TxManager
+	sessions   service.SessionService
+	events     events.Publisher
+	mailer     mailer.Mailer
+	keys       *signing.KeySet
+	log        *slog.Logger
+	cfg        *config.Config
 }
 
 func NewUserService(
 	userRepo repository.UserRepository,
 	taskRepo repository.TaskRepository,
+	ledgerRepo repository.LedgerRepository,
+	tokenRepo repository.TokenRepository,
+	txManager repository.TxManager,
+	sessions service.SessionService,
+	events events.Publisher,
+	mailer mailer.Mailer,
+	keys *signing.KeySet,
 	log *slog.Logger,
 	cfg *config.Config,
 ) service.UserService {
 	return &userService{
-		userRepo: userRepo,
-		taskRepo: taskRepo,
-		log:      log,
-		cfg:      cfg,
+		userRepo:   userRepo,
+		taskRepo:   taskRepo,
+		ledgerRepo: ledgerRepo,
+		tokenRepo:  tokenRepo,
+		txManager:  txManager,
+		sessions:   sessions,
+		events:     events,
+		mailer:     mailer,
+		keys:       keys,
+		log:        log,
+		cfg:        cfg,
 	}
 }
 
-func (service *userService) Register(ctx context.Context, email string, password string) error {
+const (
+	// referralCodeLength is the length of generated referral codes.
+	referralCodeLength = 8
+	// referralCodeAttempts bounds retries when a generated code is taken.
+	referralCodeAttempts = 5
+
+	maxDisplayNameLength = 32
+	maxAvatarURLLength   = 2000
+)
+
+// vanityCodePattern is what users may pick as their own referral code, after
+// upper-casing.
+var vanityCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{4,20}$`)
+
+// localePattern is a language subtag followed by optional script, region or
+// variant subtags.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+func normalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Register creates a user with a fresh referral code and mails them a link
+// to verify their address. When referralCode is set, the owner of that code
+// becomes the new user's referrer; the signup bonus waits for verification.
+func (service *userService) Register(ctx context.Context, email string, password string, referralCode string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		service.log.Error("failed to hash password", slog.String("error", err.Error()))
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
-	err = service.userRepo.CreateUser(ctx, email, hashedPassword)
+
+	var userID int
+	err = service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		userID, err = service.createUser(ctx, email, hashedPassword)
+		if err != nil {
+			return err
+		}
+		if referralCode == "" {
+			return nil
+		}
+		return service.setReferrer(ctx, userID, referralCode)
+	})
 	if err != nil {
 		if errors.Is(err, storeerrors.ErrUserExists) {
 			return serviceerrors.ErrUserAlreadyExists
 		}
-		return fmt.Errorf("failed to create user: %w", err)
+		return err
 	}
 	service.log.Info("user created", slog.String("email", email))
 
+	// The account exists either way; the user can ask for another link.
+	err = service.sendVerification(ctx, userID, email)
+	if err != nil {
+		service.log.Error("Failed to send verification email", slog.Int("userID", userID), slog.String("error", err.Error()))
+	}
+
 	return nil
 }
 
-func (service *userService) Login(ctx context.Context, email string, password string) (string, error) {
+// createUser inserts the user, drawing a new referral code until one is free.
+func (service *userService) createUser(ctx context.Context, email string, hashedPassword []byte) (int, error) {
+	for range referralCodeAttempts {
+		code, err := utills.ReferralCode(referralCodeLength)
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate referral code: %w", err)
+		}
+
+		userID, err := service.userRepo.CreateUser(ctx, email, hashedPassword, code)
+		if errors.Is(err, storeerrors.ErrReferralCodeTaken) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to create user: %w", err)
+		}
+		return userID, nil
+	}
+	return 0, errors.New("failed to create user: no free referral code")
+}
+
+func (service *userService) Login(ctx context.Context, email string, password string) (*models.TokenPair, error) {
+	// Emails are stored normalized. Accounts created before registration
+	// checked addresses may hold ones that do not parse; those are looked
+	// up as given.
+	if normalized, err := normalizeEmail(email); err == nil {
+		email = normalized
+	}
+
 	user, err := service.userRepo.GetUserByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, storeerrors.ErrUserNotFound) {
-			return "", serviceerrors.ErrUserNotFound
+			return nil, serviceerrors.ErrUserNotFound
 		}
-		return "", fmt.Errorf("service: failed to get user by email: %w", err)
+		return nil, fmt.Errorf("service: failed to get user by email: %w", err)
 	}
 	err = utills.VerifyPassword(string(user.HashPassword), password)
 	if err != nil {
 		service.log.Warn("invalid password", slog.String("email", email))
-		return "", serviceerrors.ErrInvalidPassword
+		return nil, serviceerrors.ErrInvalidPassword
 	}
 
-	token, err := utills.GenerateToken(user.ID, user.Email, []byte(service.cfg.SecretKey), service.cfg.JwtTTL)
+	familyID, err := utills.RandomToken(16)
 	if err != nil {
-		service.log.Error("Failed to generate jwt token", slog.String("error", err.Error()))
-		return "", fmt.Errorf("failed to generate jwt token: %w", err)
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	tokens, err := service.issueTokens(ctx, user, familyID)
+	if err != nil {
+		return nil, err
 	}
 
 	service.log.Info("User successfully logged", slog.String("email", email))
-	return token, nil
+	return tokens, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair. Every refresh
+// token can be used once; presenting one that was already rotated means it
+// leaked, so the whole family is revoked.
+func (service *userService) RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	var (
+		tokens *models.TokenPair
+		reused bool
+	)
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := service.tokenRepo.GetRefreshTokenByHash(ctx, utills.HashToken(refreshToken))
+		if err != nil {
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+
+		if stored.RevokedAt != nil {
+			return serviceerrors.ErrInvalidToken
+		}
+		if stored.UsedAt != nil {
+			reused = true
+			service.log.Warn("Refresh token reuse detected", slog.Int("userID", stored.UserID), slog.String("family_id", stored.FamilyID))
+			return service.tokenRepo.RevokeRefreshFamily(ctx, stored.FamilyID)
+		}
+		if time.Now().UTC().After(stored.ExpiresAt) {
+			return serviceerrors.ErrInvalidToken
+		}
+
+		err = service.tokenRepo.MarkRefreshTokenUsed(ctx, stored.ID)
+		if err != nil {
+			return fmt.Errorf("failed to mark refresh token used: %w", err)
+		}
+
+		user, err := service.userRepo.GetUserByID(ctx, stored.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		tokens, err = service.issueTokens(ctx, user, stored.FamilyID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrTokenNotFound) || errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if reused {
+		return nil, serviceerrors.ErrTokenReused
+	}
+
+	service.log.Info("Tokens successfully refreshed")
+	return tokens, nil
+}
+
+// issueTokens signs a new access token and stores a new refresh token in the
+// given family.
+func (service *userService) issueTokens(ctx context.Context, user *models.User, familyID string) (*models.TokenPair, error) {
+	accessToken, err := utills.GenerateToken(user, service.keys, service.cfg.JwtTTL)
+	if err != nil {
+		service.log.Error("Failed to generate jwt token", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed to generate jwt token: %w", err)
+	}
+
+	refreshToken, err := utills.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	err = service.tokenRepo.CreateRefreshToken(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utills.HashToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(service.cfg.RefreshTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(service.cfg.JwtTTL.Seconds()),
+	}, nil
 }
 
-func (service *userService) GetLeaderboard(ctx context.Context, limit int) ([]models.User, error) {
-	users, err := service.userRepo.GetLeaderboard(ctx, limit)
+func (service *userService) GetLeaderboard(ctx context.Context, query models.LeaderboardQuery) (*models.LeaderboardPage, error) {
+	if query.Period == "" {
+		query.Period = models.PeriodAll
+	}
+	if !query.Period.Valid() {
+		return nil, serviceerrors.ErrInvalidFilter
+	}
+	since := query.Period.Start(time.Now())
+
+	firstRank := query.Offset + 1
+	if query.Cursor != nil {
+		// Ids are integers, so everyone ahead of (points, id+1) is exactly
+		// the users at or ahead of the cursor, whether or not the cursor
+		// user still holds that position.
+		ahead, _, err := service.userRepo.CountRankedAhead(ctx, since, models.LeaderboardCursor{Points: query.Cursor.Points, ID: query.Cursor.ID + 1})
+		if err != nil {
+			return nil, fmt.Errorf("failed to count rank: %w", err)
+		}
+		firstRank = ahead + 1
+	}
+
+	users, err := service.userRepo.GetLeaderboard(ctx, since, query.Cursor, query.Offset, query.Limit+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
 	}
 
-	service.log.Info("Leaderboard successfully got")
-	return users, nil
+	page := models.LeaderboardPage{Period: query.Period, Limit: query.Limit}
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+		last := users[len(users)-1]
+		page.NextCursor = models.LeaderboardCursor{Points: last.Points, ID: last.ID}.String()
+	}
+	page.Entries = rankEntries(users, firstRank)
+
+	service.log.Info("Leaderboard successfully got", slog.String("period", string(query.Period)))
+	return &page, nil
+}
+
+// GetRank returns the user's position on the leaderboard for the period.
+func (service *userService) GetRank(ctx context.Context, userID int, period models.Period) (*models.UserRank, error) {
+	if !period.Valid() {
+		return nil, serviceerrors.ErrInvalidFilter
+	}
+
+	user, err := service.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rank, err := service.rankOf(ctx, user, period)
+	if err != nil {
+		return nil, err
+	}
+
+	service.log.Info("Rank successfully got", slog.Int("userID", userID))
+	return rank, nil
+}
+
+// rankOf ranks the user by the points earned in the period. A user with no
+// points in the period is ranked as having zero, and counted in the total.
+// So is a user hidden from the leaderboard, who still sees where they would
+// stand.
+func (service *userService) rankOf(ctx context.Context, user *models.User, period models.Period) (*models.UserRank, error) {
+	since := period.Start(time.Now())
+	points, ranked := user.Points, true
+	if since != nil {
+		var err error
+		points, ranked, err = service.userRepo.GetPeriodPoints(ctx, user.ID, *since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get period points: %w", err)
+		}
+	}
+
+	ahead, total, err := service.userRepo.CountRankedAhead(ctx, since, models.LeaderboardCursor{Points: points, ID: user.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rank: %w", err)
+	}
+	if !ranked || user.HideFromLeaderboard {
+		total++
+	}
+
+	rank := models.UserRank{
+		Period: period,
+		UserID: user.ID,
+		Points: points,
+		Rank:   ahead + 1,
+		Total:  total,
+	}
+	rank.Percentile = math.Round(float64(total-ahead)/float64(total)*10000) / 100
+	return &rank, nil
 }
 
-func (service *userService) SetReferrer(ctx context.Context, userID int, referrerID int) error {
-	if referrerID == 0 {
-		return serviceerrors.ErrUserNotFound
+// GetLeaderboardAround returns up to n users ranked right above and right
+// below the user, with the user in between.
+func (service *userService) GetLeaderboardAround(ctx context.Context, userID int, n int, period models.Period) (*models.LeaderboardAround, error) {
+	if !period.Valid() {
+		return nil, serviceerrors.ErrInvalidFilter
 	}
 
-	err := service.userRepo.SetReferrer(ctx, userID, referrerID)
+	user, err := service.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rank, err := service.rankOf(ctx, user, period)
+	if err != nil {
+		return nil, err
+	}
+	since := period.Start(time.Now())
+	position := models.LeaderboardCursor{Points: rank.Points, ID: user.ID}
+
+	above, err := service.userRepo.GetLeaderboardBefore(ctx, since, position, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users above: %w", err)
+	}
+	below, err := service.userRepo.GetLeaderboard(ctx, since, &position, 0, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users below: %w", err)
+	}
+
+	users := make([]models.User, 0, len(above)+1+len(below))
+	users = append(users, above...)
+	// Only the fields the leaderboard query selects for everyone else.
+	users = append(users, models.User{
+		ID:          user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		Points:      rank.Points,
+	})
+	users = append(users, below...)
+
+	service.log.Info("Leaderboard around user successfully got", slog.Int("userID", userID))
+	return &models.LeaderboardAround{
+		UserRank: *rank,
+		Entries:  rankEntries(users, rank.Rank-len(above)),
+	}, nil
+}
+
+// rankEntries numbers consecutive leaderboard users starting at firstRank
+// and keeps only their public fields.
+func rankEntries(users []models.User, firstRank int) []models.LeaderboardEntry {
+	entries := make([]models.LeaderboardEntry, len(users))
+	for i, user := range users {
+		entries[i] = models.LeaderboardEntry{
+			Rank:        firstRank + i,
+			UserID:      user.ID,
+			DisplayName: user.PublicName(),
+			AvatarURL:   user.AvatarURL,
+			Points:      user.Points,
+		}
+	}
+	return entries
+}
+
+func (service *userService) SetReferrer(ctx context.Context, userID int, referralCode string) error {
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return service.setReferrer(ctx, userID, referralCode)
+	})
 	if err != nil {
 		if errors.Is(err, storeerrors.ErrUserNotFound) {
 			return serviceerrors.ErrUserNotFound
 		}
-		return fmt.Errorf("failed to set referrer: %w", err)
+		return err
 	}
 
 	service.log.Info("Referrer successfully set")
 	return nil
 }
 
+// setReferrer makes the owner of referralCode the referrer of userID. The
+// referrer can be set only once, must have registered before the user and
+// must not be the user or anyone the user brought in. It must run inside a
+// transaction.
+func (service *userService) setReferrer(ctx context.Context, userID int, referralCode string) error {
+	code := normalizeReferralCode(referralCode)
+	if code == "" {
+		return serviceerrors.ErrInvalidCode
+	}
+
+	// Without the lock two concurrent requests could both pass the cycle
+	// check below and commit a cycle between them.
+	err := service.userRepo.LockReferralGraph(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to lock referral graph: %w", err)
+	}
+
+	user, err := service.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.ReferrerID != nil {
+		return serviceerrors.ErrReferrerAlreadySet
+	}
+
+	referrer, err := service.userRepo.GetUserByReferralCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrReferrerNotFound
+		}
+		return fmt.Errorf("failed to get referrer: %w", err)
+	}
+	if referrer.ID == userID {
+		return serviceerrors.ErrSelfReferral
+	}
+
+	cycle, err := service.userRepo.IsInReferralChain(ctx, userID, referrer.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check referral chain: %w", err)
+	}
+	if cycle {
+		return serviceerrors.ErrReferralCycle
+	}
+	if !referrer.CreatedAt.Before(user.CreatedAt) {
+		return serviceerrors.ErrReferrerTooNew
+	}
+
+	err = service.userRepo.SetReferrer(ctx, userID, referrer.ID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrReferrerSet) {
+			return serviceerrors.ErrReferrerAlreadySet
+		}
+		return fmt.Errorf("failed to set referrer: %w", err)
+	}
+
+	// Unverified users get the bonus when they verify their email.
+	if !user.EmailVerified {
+		return nil
+	}
+	return service.creditSignupBonus(ctx, user.ID, referrer)
+}
+
+// creditSignupBonus rewards both sides of a new referral. Each entry points
+// at the other user as its source. The user must have a verified email; the
+// referrer is only paid if they have one too.
+func (service *userService) creditSignupBonus(ctx context.Context, userID int, referrer *models.User) error {
+	bonuses := []models.PointTransaction{
+		{UserID: referrer.ID, Delta: service.cfg.ReferralCfg.ReferrerBonus, SourceUserID: &userID},
+		{UserID: userID, Delta: service.cfg.ReferralCfg.RefereeBonus, SourceUserID: &referrer.ID},
+	}
+	for _, bonus := range bonuses {
+		if bonus.Delta <= 0 {
+			continue
+		}
+		if bonus.UserID == referrer.ID && !referrer.EmailVerified {
+			continue
+		}
+		bonus.Reason = models.ReasonReferralSignup
+		err := service.addPoints(ctx, &bonus)
+		if err != nil {
+			return fmt.Errorf("failed to credit referral bonus: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetReferralCode replaces the user's referral code with a vanity code.
+func (service *userService) SetReferralCode(ctx context.Context, userID int, code string) (string, error) {
+	code = normalizeReferralCode(code)
+	if !vanityCodePattern.MatchString(code) {
+		return "", serviceerrors.ErrInvalidCode
+	}
+
+	err := service.userRepo.SetReferralCode(ctx, userID, code)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrReferralCodeTaken) {
+			return "", serviceerrors.ErrReferralCodeTaken
+		}
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return "", serviceerrors.ErrUserNotFound
+		}
+		return "", fmt.Errorf("failed to set referral code: %w", err)
+	}
+
+	service.log.Info("Referral code successfully set", slog.Int("userID", userID))
+	return code, nil
+}
+
 func (service *userService) Status(ctx context.Context, ID int) (*models.UserStatus, error) {
 	if ID == 0 {
 		service.log.Error("User not found", slog.Int("userID", ID))
@@ -125,40 +579,886 @@ func (service *userService) Status(ctx context.Context, ID int) (*models.UserSta
 		return nil, fmt.Errorf("failed to get user tasks: %w", err)
 	}
 	status := models.UserStatus{
-		ID:         user.ID,
-		Email:      user.Email,
-		Points:     user.Points,
-		ReferrerID: user.ReferrerID,
-		Tasks:      userTasks,
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Points:        user.Points,
+		ReferrerID:    user.ReferrerID,
+		ReferralCode:  user.ReferralCode,
+		Tasks:         userTasks,
 	}
 
 	service.log.Info("Status successfully got")
 	return &status, nil
 }
 
-func (service *userService) CompleteTask(ctx context.Context, userID int, taskID int) error {
-	task, err := service.taskRepo.GetTaskByID(ctx, taskID)
+func (service *userService) GetProfile(ctx context.Context, userID int) (*models.Profile, error) {
+	user, err := service.userRepo.GetUserByID(ctx, userID)
 	if err != nil {
-		if errors.Is(err, storeerrors.ErrTaskNotFound) {
-			return serviceerrors.ErrTaskNotFound
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	service.log.Info("Profile successfully got", slog.Int("userID", userID))
+	return profileOf(user), nil
+}
+
+// UpdateProfile changes the user's profile settings. Only the fields present
+// in req are touched.
+func (service *userService) UpdateProfile(ctx context.Context, userID int, req models.UpdateProfileRequest) (*models.Profile, error) {
+	var user *models.User
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = service.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if req.DisplayName != nil {
+			user.DisplayName, err = normalizeDisplayName(*req.DisplayName)
+			if err != nil {
+				return err
+			}
+		}
+		if req.AvatarURL != nil {
+			user.AvatarURL, err = normalizeAvatarURL(*req.AvatarURL)
+			if err != nil {
+				return err
+			}
+		}
+		if req.HideFromLeaderboard != nil {
+			user.HideFromLeaderboard = *req.HideFromLeaderboard
+		}
+		if req.Locale != nil {
+			user.Locale, err = normalizeLocale(*req.Locale)
+			if err != nil {
+				return err
+			}
+		}
+		if req.Timezone != nil {
+			user.Timezone, err = normalizeTimezone(*req.Timezone)
+			if err != nil {
+				return err
+			}
+		}
+
+		return service.userRepo.UpdateProfile(ctx, user)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storeerrors.ErrUserNotFound):
+			return nil, serviceerrors.ErrUserNotFound
+		case errors.Is(err, storeerrors.ErrDisplayNameTaken):
+			return nil, serviceerrors.ErrDisplayNameTaken
+		case errors.Is(err, serviceerrors.ErrInvalidProfile):
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	service.log.Info("Profile successfully updated", slog.Int("userID", userID))
+	return profileOf(user), nil
+}
+
+func profileOf(user *models.User) *models.Profile {
+	return &models.Profile{
+		ID:                  user.ID,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerified,
+		DisplayName:         user.DisplayName,
+		AvatarURL:           user.AvatarURL,
+		HideFromLeaderboard: user.HideFromLeaderboard,
+		Locale:              user.Locale,
+		Timezone:            user.Timezone,
+	}
+}
+
+// normalizeDisplayName trims the name and checks that it is printable and
+// not too long. An empty name clears it.
+func normalizeDisplayName(name string) (*string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return nil, serviceerrors.ErrInvalidProfile
+		}
+	}
+	return &name, nil
+}
+
+// normalizeAvatarURL accepts absolute http(s) URLs. An empty URL clears the
+// avatar.
+func normalizeAvatarURL(avatarURL string) (*string, error) {
+	avatarURL = strings.TrimSpace(avatarURL)
+	if avatarURL == "" {
+		return nil, nil
+	}
+	if len(avatarURL) > maxAvatarURLLength {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	return &avatarURL, nil
+}
+
+// normalizeLocale accepts BCP 47 style tags such as "en" or "pt-BR". An
+// empty locale clears it.
+func normalizeLocale(locale string) (*string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return nil, nil
+	}
+	if !localePattern.MatchString(locale) {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	return &locale, nil
+}
+
+// normalizeTimezone accepts IANA zone names such as "Europe/Moscow". An
+// empty timezone clears it.
+func normalizeTimezone(timezone string) (*string, error) {
+	timezone = strings.TrimSpace(timezone)
+	if timezone == "" {
+		return nil, nil
+	}
+	if timezone == "Local" {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, serviceerrors.ErrInvalidProfile
+	}
+	return &timezone, nil
+}
+
+// ChangePassword replaces the password after checking the current one and
+// signs out every session of the user. The returned token pair keeps the
+// caller signed in.
+func (service *userService) ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string) (*models.TokenPair, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		service.log.Error("failed to hash password", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var tokens *models.TokenPair
+	err = service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := service.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := utills.VerifyPassword(string(user.HashPassword), currentPassword); err != nil {
+			return serviceerrors.ErrInvalidPassword
+		}
+
+		err = service.userRepo.SetPassword(ctx, userID, hashedPassword)
+		if err != nil {
+			return fmt.Errorf("failed to set password: %w", err)
+		}
+
+		// The watermark is rounded down to the precision of iat, so the
+		// pair issued below stays valid. Other instances notice it within
+		// JWT_REVOCATION_CACHE_TTL.
+		err = service.sessions.RevokeAll(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+
+		familyID, err := utills.RandomToken(16)
+		if err != nil {
+			return fmt.Errorf("failed to generate token family: %w", err)
+		}
+		tokens, err = service.issueTokens(ctx, user, familyID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	service.log.Info("Password successfully changed", slog.Int("userID", userID))
+	return tokens, nil
+}
+
+// RequestEmailChange checks the password and mails a verification link to
+// the new address. The email only changes once the link is followed.
+func (service *userService) RequestEmailChange(ctx context.Context, userID int, email string, password string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := service.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := utills.VerifyPassword(string(user.HashPassword), password); err != nil {
+		return serviceerrors.ErrInvalidPassword
+	}
+
+	_, err = service.userRepo.GetUserByEmail(ctx, email)
+	if err == nil {
+		return serviceerrors.ErrUserAlreadyExists
+	}
+	if !errors.Is(err, storeerrors.ErrUserNotFound) {
+		return fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	err = service.sendVerification(ctx, userID, email)
+	if err != nil {
+		return err
+	}
+
+	service.log.Info("Email change successfully requested", slog.Int("userID", userID))
+	return nil
+}
+
+// sendVerification records a pending verification of email and mails a
+// signed link to it. The token names the verification row and its expiry;
+// the row makes it single-use. Links sent to the user before stop working,
+// so an old link cannot switch the email back to an earlier address.
+func (service *userService) sendVerification(ctx context.Context, userID int, email string) error {
+	verification := models.EmailVerification{
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(service.cfg.EmailCfg.TokenTTL),
+	}
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		err := service.tokenRepo.CreateEmailVerification(ctx, &verification)
+		if err != nil {
+			return fmt.Errorf("failed to create email verification: %w", err)
+		}
+		err = service.tokenRepo.InvalidateEmailVerifications(ctx, userID, verification.ID)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate email verifications: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := strconv.FormatInt(verification.ID, 10) + "." + strconv.FormatInt(verification.ExpiresAt.Unix(), 10)
+	token := utills.SignToken([]byte(service.cfg.EmailCfg.TokenSecret), payload)
+
+	err = service.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: "Follow the link to confirm your email address:\n\n" +
+			service.cfg.EmailCfg.VerifyURL + url.QueryEscape(token) + "\n\n" +
+			"The link expires at " + verification.ExpiresAt.Format(time.RFC1123) + ".",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	return nil
+}
+
+// ResendVerification mails a new verification link to a user who has not
+// verified their email yet.
+func (service *userService) ResendVerification(ctx context.Context, userID int) error {
+	user, err := service.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrUserNotFound
 		}
-		return fmt.Errorf("failed to get task: %w", err)
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.EmailVerified {
+		return serviceerrors.ErrAlreadyVerified
+	}
+
+	err = service.sendVerification(ctx, userID, user.Email)
+	if err != nil {
+		return err
 	}
 
-	err = service.taskRepo.CompleteTask(ctx, userID, taskID)
+	service.log.Info("Verification email successfully resent", slog.Int("userID", userID))
+	return nil
+}
+
+// VerifyEmail redeems a verification token and makes its address the
+// user's verified email. The user's other pending links stop working, and a
+// changed address signs out every session like a password change does. The
+// first verification also pays the referral signup bonus that was held back
+// at registration.
+func (service *userService) VerifyEmail(ctx context.Context, token string) error {
+	payload, err := utills.VerifySignedToken([]byte(service.cfg.EmailCfg.TokenSecret), token)
+	if err != nil {
+		return serviceerrors.ErrInvalidVerifyToken
+	}
+	idPart, expiresPart, _ := strings.Cut(payload, ".")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return serviceerrors.ErrInvalidVerifyToken
+	}
+	expires, err := strconv.ParseInt(expiresPart, 10, 64)
+	if err != nil {
+		return serviceerrors.ErrInvalidVerifyToken
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return serviceerrors.ErrVerifyTokenExpired
+	}
+
+	var verification *models.EmailVerification
+	err = service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		verification, err = service.tokenRepo.GetEmailVerification(ctx, id)
+		if err != nil {
+			return err
+		}
+		if verification.UsedAt != nil {
+			return serviceerrors.ErrInvalidVerifyToken
+		}
+
+		err = service.tokenRepo.MarkEmailVerificationUsed(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to mark email verification used: %w", err)
+		}
+		err = service.tokenRepo.InvalidateEmailVerifications(ctx, verification.UserID, id)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate email verifications: %w", err)
+		}
+
+		user, err := service.userRepo.GetUserByID(ctx, verification.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		err = service.userRepo.SetVerifiedEmail(ctx, verification.UserID, verification.Email)
+		if err != nil {
+			return err
+		}
+
+		if user.Email != verification.Email {
+			err = service.sessions.RevokeAll(ctx, user.ID)
+			if err != nil {
+				return fmt.Errorf("failed to revoke sessions: %w", err)
+			}
+		}
+		if user.EmailVerified || user.ReferrerID == nil {
+			return nil
+		}
+
+		referrer, err := service.userRepo.GetUserByID(ctx, *user.ReferrerID)
+		if err != nil {
+			return fmt.Errorf("failed to get referrer: %w", err)
+		}
+		return service.creditSignupBonus(ctx, user.ID, referrer)
+	})
 	if err != nil {
-		if errors.Is(err, storeerrors.ErrTaskCompleted) {
+		switch {
+		case errors.Is(err, storeerrors.ErrTokenNotFound):
+			return serviceerrors.ErrInvalidVerifyToken
+		case errors.Is(err, storeerrors.ErrUserExists):
+			return serviceerrors.ErrUserAlreadyExists
+		case errors.Is(err, storeerrors.ErrUserNotFound):
+			return serviceerrors.ErrUserNotFound
+		case errors.Is(err, serviceerrors.ErrInvalidVerifyToken):
+			return err
+		}
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	service.log.Info("Email successfully verified", slog.Int("userID", verification.UserID))
+	return nil
+}
+
+// normalizeEmail trims the address and checks that it is a bare address
+// without a display name.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", serviceerrors.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// CompleteTask records a completion of the task. Auto-verified tasks are
+// credited right away; the others wait in the moderation queue and the
+// returned submission is pending.
+func (service *userService) CompleteTask(ctx context.Context, userID int, taskID int, proof *models.TaskProof) (*models.Submission, error) {
+	return service.completeTask(ctx, userID, taskID, proof, "")
+}
+
+// ConfirmTask completes a task on behalf of a partner. The completion is
+// trusted and credited right away, but only for tasks of that provider.
+func (service *userService) ConfirmTask(ctx context.Context, provider string, userID int, taskID int) (*models.Submission, error) {
+	return service.completeTask(ctx, userID, taskID, nil, provider)
+}
+
+// completeTask is shared by user and partner completions. An empty provider
+// means the user claims the completion themselves.
+func (service *userService) completeTask(ctx context.Context, userID int, taskID int, proof *models.TaskProof, provider string) (*models.Submission, error) {
+	if proof != nil {
+		err := validateProof(proof)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	submission := models.Submission{
+		UserID: userID,
+		TaskID: taskID,
+		Status: models.SubmissionApproved,
+		Proof:  proof,
+	}
+	var reward int
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := service.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if !user.EmailVerified {
+			return serviceerrors.ErrEmailNotVerified
+		}
+
+		task, err := service.taskRepo.GetTaskByID(ctx, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to get task: %w", err)
+		}
+		if task.ArchivedAt != nil {
+			return serviceerrors.ErrTaskArchived
+		}
+		if provider != "" {
+			if task.Provider == nil || *task.Provider != provider {
+				return serviceerrors.ErrTaskNotFound
+			}
+		} else {
+			if task.Verification == models.VerificationWebhook {
+				return serviceerrors.ErrPartnerOnly
+			}
+			if task.Verification == models.VerificationProof && proof == nil {
+				return serviceerrors.ErrProofRequired
+			}
+			if task.Verification != models.VerificationAuto {
+				submission.Status = models.SubmissionPending
+			}
+		}
+
+		now := time.Now()
+		if task.StartsAt != nil && now.Before(*task.StartsAt) {
+			return serviceerrors.ErrTaskNotStarted
+		}
+		if task.EndsAt != nil && !now.Before(*task.EndsAt) {
+			return serviceerrors.ErrTaskEnded
+		}
+
+		err = service.taskRepo.LockUserTask(ctx, userID, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to lock task: %w", err)
+		}
+
+		completions, last, err := service.taskRepo.GetCompletionStats(ctx, userID, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to get completion stats: %w", err)
+		}
+
+		next, ok := task.NextCompletionAt(completions, last)
+		if !ok {
 			return serviceerrors.ErrTaskAlreadyDone
 		}
-		return fmt.Errorf("failed to complete task: %w", err)
+		if now.Before(next) {
+			return &serviceerrors.CooldownError{RetryAfter: next}
+		}
+
+		err = service.checkUnlocked(ctx, userID, task)
+		if err != nil {
+			return err
+		}
+
+		// The cap counts users, so only a user's first completion takes a slot.
+		if completions == 0 {
+			err = service.taskRepo.ReserveCompletion(ctx, taskID)
+			if err != nil {
+				return fmt.Errorf("failed to reserve completion: %w", err)
+			}
+		}
+
+		err = service.taskRepo.CompleteTask(ctx, &submission)
+		if err != nil {
+			return fmt.Errorf("failed to complete task: %w", err)
+		}
+
+		if submission.Status != models.SubmissionApproved {
+			return nil
+		}
+		reward, err = service.creditCompletion(ctx, task, &submission)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrTaskNotFound) {
+			return nil, serviceerrors.ErrTaskNotFound
+		}
+		if errors.Is(err, storeerrors.ErrCapReached) {
+			return nil, serviceerrors.ErrTaskCapReached
+		}
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if submission.Status == models.SubmissionPending {
+		service.log.Info("Task successfully submitted for review", slog.Int("taskID", taskID), slog.Int("userID", userID), slog.Int64("submissionID", submission.ID))
+		return &submission, nil
+	}
+
+	service.log.Info("Task successfully completed", slog.Int("taskID", taskID), slog.Int("userID", userID), slog.Int("reward", reward))
+	return &submission, nil
+}
+
+// releaseCompletion gives the user's slot back to the task's completion cap
+// once none of their completions of the task are left.
+func (service *userService) releaseCompletion(ctx context.Context, userID int, taskID int) error {
+	err := service.taskRepo.LockUserTask(ctx, userID, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to lock task: %w", err)
+	}
+
+	completions, _, err := service.taskRepo.GetCompletionStats(ctx, userID, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to get completion stats: %w", err)
+	}
+	if completions > 0 {
+		return nil
+	}
+
+	err = service.taskRepo.ReleaseCompletion(ctx, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to release completion: %w", err)
+	}
+	return nil
+}
+
+// addPoints writes a ledger entry and lets subscribers know about the new
+// balance once the surrounding transaction commits.
+func (service *userService) addPoints(ctx context.Context, entry *models.PointTransaction) error {
+	err := service.userRepo.AddPoints(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	event := events.Event{Kind: events.KindPointsChanged, UserID: entry.UserID, Delta: entry.Delta}
+	service.txManager.AfterCommit(ctx, func() {
+		service.events.Publish(event)
+	})
+	return nil
+}
+
+// creditCompletion pays out an approved submission. The reward is taken at
+// the time the task was completed, not the time it was reviewed.
+func (service *userService) creditCompletion(ctx context.Context, task *models.Task, submission *models.Submission) (int, error) {
+	reward := task.RewardAt(submission.CompletedAt)
+	err := service.addPoints(ctx, &models.PointTransaction{
+		UserID: submission.UserID,
+		Delta:  reward,
+		Reason: models.ReasonTaskCompleted,
+		TaskID: &task.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to add points: %w", err)
+	}
+
+	err = service.creditCommission(ctx, submission.UserID, task.ID, reward)
+	if err != nil {
+		return 0, err
+	}
+	return reward, nil
+}
+
+// creditCommission pays every referrer above the user the share of a task
+// reward configured for their level. Shares are rounded down, so small
+// rewards may pay nothing, and referrers without a verified email are
+// skipped.
+func (service *userService) creditCommission(ctx context.Context, userID int, taskID int, reward int) error {
+	tiers := service.cfg.ReferralCfg.CommissionTiers
+	if len(tiers) == 0 || reward <= 0 {
+		return nil
+	}
+
+	chain, err := service.userRepo.GetReferrerChain(ctx, userID, len(tiers))
+	if err != nil {
+		return fmt.Errorf("failed to get referrer chain: %w", err)
+	}
+
+	for level, referrer := range chain {
+		commission := reward * tiers[level] / 100
+		if commission <= 0 || !referrer.EmailVerified {
+			continue
+		}
+		err = service.addPoints(ctx, &models.PointTransaction{
+			UserID:       referrer.ID,
+			Delta:        commission,
+			Reason:       models.ReasonReferralCommission,
+			TaskID:       &taskID,
+			SourceUserID: &userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to credit referral commission: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetReferralStats returns the user's referral counters together with the
+// daily signups over the last days days, today included.
+func (service *userService) GetReferralStats(ctx context.Context, userID int, days int) (*models.ReferralStats, error) {
+	stats, err := service.userRepo.GetReferralStats(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referral stats: %w", err)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	stats.Signups, err = service.userRepo.GetReferralSignups(ctx, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referral signups: %w", err)
+	}
+	if stats.Signups == nil {
+		stats.Signups = []models.DailyCount{}
+	}
+
+	service.log.Info("Referral stats successfully got", slog.Int("userID", userID))
+	return stats, nil
+}
+
+// GetReferrals returns the user's downline as a tree, depth levels deep.
+func (service *userService) GetReferrals(ctx context.Context, userID int, depth int) (*models.ReferralTree, error) {
+	nodes, err := service.userRepo.GetDownline(ctx, userID, depth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referrals: %w", err)
+	}
+
+	tree := models.ReferralTree{
+		UserID:    userID,
+		Depth:     depth,
+		Count:     len(nodes),
+		Referrals: []*models.ReferralNode{},
+	}
+	// Nodes come ordered by level, so every parent is indexed before its
+	// children are attached to it.
+	byID := make(map[int]*models.ReferralNode, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		node.Referrals = []*models.ReferralNode{}
+		byID[node.UserID] = node
+		tree.TotalCommission += node.Commission
+
+		if node.Level == 1 {
+			tree.Referrals = append(tree.Referrals, node)
+		} else if parent, ok := byID[node.ReferrerID]; ok {
+			parent.Referrals = append(parent.Referrals, node)
+		}
+	}
+
+	service.log.Info("Referrals successfully got", slog.Int("userID", userID), slog.Int("depth", depth))
+	return &tree, nil
+}
+
+func (service *userService) ListSubmissions(ctx context.Context, status models.SubmissionStatus, limit int, offset int) (*models.SubmissionsPage, error) {
+	switch status {
+	case models.SubmissionPending, models.SubmissionApproved, models.SubmissionRejected:
+	default:
+		return nil, serviceerrors.ErrInvalidFilter
+	}
+
+	submissions, err := service.taskRepo.ListSubmissions(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submissions: %w", err)
+	}
+	if submissions == nil {
+		submissions = []models.Submission{}
+	}
+
+	service.log.Info("Submissions successfully listed", slog.String("status", string(status)))
+	return &models.SubmissionsPage{Submissions: submissions, Limit: limit, Offset: offset}, nil
+}
+
+// ReviewSubmission approves or rejects a pending submission. Approval credits
+// the reward; rejecting a user's only completion gives their slot back to the
+// task's completion cap.
+// Moderators cannot review their own submissions.
+func (service *userService) ReviewSubmission(ctx context.Context, moderatorID int, submissionID int64, approve bool, comment string) (*models.Submission, error) {
+	var submission *models.Submission
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		submission, err = service.taskRepo.GetSubmission(ctx, submissionID)
+		if err != nil {
+			return fmt.Errorf("failed to get submission: %w", err)
+		}
+		if submission.Status != models.SubmissionPending {
+			return serviceerrors.ErrSubmissionNotFound
+		}
+		if submission.UserID == moderatorID {
+			return serviceerrors.ErrSelfReview
+		}
+
+		now := time.Now().UTC()
+		submission.Status = models.SubmissionRejected
+		if approve {
+			submission.Status = models.SubmissionApproved
+		}
+		submission.ReviewedBy = &moderatorID
+		submission.ReviewedAt = &now
+		if comment != "" {
+			submission.ReviewComment = &comment
+		}
+
+		err = service.taskRepo.ReviewSubmission(ctx, submission)
+		if err != nil {
+			return fmt.Errorf("failed to review submission: %w", err)
+		}
+
+		if !approve {
+			return service.releaseCompletion(ctx, submission.UserID, submission.TaskID)
+		}
+
+		task, err := service.taskRepo.GetTaskByID(ctx, submission.TaskID)
+		if err != nil {
+			return fmt.Errorf("failed to get task: %w", err)
+		}
+		_, err = service.creditCompletion(ctx, task, submission)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrSubmissionNotFound) {
+			return nil, serviceerrors.ErrSubmissionNotFound
+		}
+		return nil, err
+	}
+
+	service.log.Info("Submission successfully reviewed",
+		slog.Int64("submissionID", submissionID),
+		slog.Int("moderatorID", moderatorID),
+		slog.String("status", string(submission.Status)))
+	return submission, nil
+}
+
+func (service *userService) GetTransactions(ctx context.Context, userID int, cursor int64, limit int) (*models.TransactionsPage, error) {
+	transactions, err := service.ledgerRepo.GetUserTransactions(ctx, userID, cursor, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+
+	page := models.TransactionsPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = strconv.FormatInt(page.Transactions[limit-1].ID, 10)
+	}
+	if page.Transactions == nil {
+		page.Transactions = []models.PointTransaction{}
+	}
+
+	service.log.Info("Transactions successfully got", slog.Int("userID", userID))
+	return &page, nil
+}
+
+// ReconcilePoints corrects the balances that drifted from the ledger, one
+// user per transaction. Corrections reach leaderboard subscribers the same
+// way ledger entries do.
+func (service *userService) ReconcilePoints(ctx context.Context) (int64, error) {
+	drifted, err := service.ledgerRepo.ListDriftedUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list drifted balances: %w", err)
+	}
+
+	var corrected int64
+	for _, userID := range drifted {
+		err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+			delta, err := service.userRepo.ReconcilePoints(ctx, userID)
+			if err != nil || delta == 0 {
+				return err
+			}
+
+			event := events.Event{Kind: events.KindPointsChanged, UserID: userID, Delta: delta}
+			service.txManager.AfterCommit(ctx, func() {
+				service.events.Publish(event)
+			})
+			corrected++
+			return nil
+		})
+		if err != nil {
+			return corrected, fmt.Errorf("failed to reconcile points: %w", err)
+		}
+	}
+
+	if corrected > 0 {
+		service.log.Warn("Balances drifted from ledger and were corrected", slog.Int64("users", corrected))
 	}
+	return corrected, nil
+}
 
-	err = service.userRepo.AddPoints(ctx, userID, task.Reward)
+func (service *userService) SetRole(ctx context.Context, userID int, role models.Role) error {
+	if !role.Valid() {
+		return serviceerrors.ErrInvalidRole
+	}
+
+	err := service.userRepo.SetRole(ctx, userID, role)
 	if err != nil {
-		return fmt.Errorf("failed to add points: %w", err)
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to set role: %w", err)
 	}
 
-	service.log.Info("Task successfully completed", slog.Int("taskID", taskID), slog.Int("userID", userID), slog.Int("reward", task.Reward))
+	service.log.Info("Role successfully set", slog.Int("userID", userID), slog.String("role", string(role)))
 	return nil
 }
 
+// checkUnlocked returns ErrTaskLocked unless the user completed every
+// prerequisite of the task and has at least task.MinPoints points.
+func (service *userService) checkUnlocked(ctx context.Context, userID int, task *models.Task) error {
+	unmet, err := service.taskRepo.GetUnmetPrerequisites(ctx, userID, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+	if len(unmet) > 0 {
+		return serviceerrors.ErrTaskLocked
+	}
+
+	if task.MinPoints > 0 {
+		user, err := service.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.Points < task.MinPoints {
+			return serviceerrors.ErrTaskLocked
+		}
+	}
+	return nil
+}
+
+// maxProofLength bounds the text, URL or file reference attached to a
+// submission.
+const maxProofLength = 2000
+
+func validateProof(proof *models.TaskProof) error {
+	if proof.Value == "" || len(proof.Value) > maxProofLength {
+		return serviceerrors.ErrInvalidProof
+	}
+
+	switch proof.Type {
+	case models.ProofText, models.ProofFile:
+		return nil
+	case models.ProofURL:
+		u, err := url.Parse(proof.Value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return serviceerrors.ErrInvalidProof
+		}
+		return nil
+	}
+	return serviceerrors.ErrInvalidProof
+}
@@ -0,0 +1,371 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCompleteTaskRollsBackOnFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		breaks func(env *testEnv)
+	}{
+		{
+			name:   "reward fails",
+			breaks: func(env *testEnv) { env.userRepo.addPointsErr = errFake },
+		},
+		{
+			name:   "commission fails after the reward",
+			breaks: func(env *testEnv) { env.userRepo.chainErr = errFake },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			tt.breaks(env)
+
+			_, err := env.service.CompleteTask(context.Background(), testUserID, testTaskID, nil)
+			if !errors.Is(err, errFake) {
+				t.Fatalf("CompleteTask() error = %v, want %v", err, errFake)
+			}
+
+			if n := len(env.db.submissions); n != 0 {
+				t.Errorf("completions after rollback = %d, want 0", n)
+			}
+			if n := len(env.db.ledger); n != 0 {
+				t.Errorf("ledger entries after rollback = %d, want 0", n)
+			}
+			for _, id := range []int{testUserID, testReferrerID} {
+				if points := env.db.users[id].Points; points != 0 {
+					t.Errorf("user %d points after rollback = %d, want 0", id, points)
+				}
+			}
+			if n := len(env.publisher.events); n != 0 {
+				t.Errorf("events published after rollback = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestCompleteTaskCommits(t *testing.T) {
+	env := newTestEnv()
+
+	_, err := env.service.CompleteTask(context.Background(), testUserID, testTaskID, nil)
+	if err != nil {
+		t.Fatalf("CompleteTask() error = %v", err)
+	}
+
+	if n := len(env.db.submissions); n != 1 {
+		t.Errorf("completions = %d, want 1", n)
+	}
+	if points := env.db.users[testUserID].Points; points != testReward {
+		t.Errorf("user points = %d, want %d", points, testReward)
+	}
+	if points := env.db.users[testReferrerID].Points; points != testReward/10 {
+		t.Errorf("referrer points = %d, want %d", points, testReward/10)
+	}
+	if n := len(env.publisher.events); n != 2 {
+		t.Errorf("events published = %d, want 2", n)
+	}
+}
+
+func TestCompletionCapCountsUsers(t *testing.T) {
+	const otherUserID = 3
+
+	env := newTestEnv()
+	env.db.users[otherUserID] = models.User{ID: otherUserID, EmailVerified: true}
+	limit, noCooldown := 1, 0
+	task := env.db.tasks[testTaskID]
+	task.Recurrence = models.RecurrenceInterval
+	task.IntervalHours = &noCooldown
+	task.CompletionCap = &limit
+	env.db.tasks[testTaskID] = task
+
+	for i := range 3 {
+		_, err := env.service.CompleteTask(context.Background(), testUserID, testTaskID, nil)
+		if err != nil {
+			t.Fatalf("completion %d: CompleteTask() error = %v", i+1, err)
+		}
+	}
+	if count := env.db.tasks[testTaskID].CompletionCount; count != 1 {
+		t.Errorf("completion count after repeats = %d, want 1", count)
+	}
+
+	_, err := env.service.CompleteTask(context.Background(), otherUserID, testTaskID, nil)
+	if !errors.Is(err, serviceerrors.ErrTaskCapReached) {
+		t.Fatalf("CompleteTask() by another user error = %v, want %v", err, serviceerrors.ErrTaskCapReached)
+	}
+}
+
+func TestRejectionReleasesCapSlot(t *testing.T) {
+	const moderatorID = 3
+
+	env := newTestEnv()
+	limit, noCooldown := 1, 0
+	task := env.db.tasks[testTaskID]
+	task.Recurrence = models.RecurrenceInterval
+	task.IntervalHours = &noCooldown
+	task.CompletionCap = &limit
+	task.Verification = models.VerificationManual
+	env.db.tasks[testTaskID] = task
+
+	var submissions []*models.Submission
+	for range 2 {
+		submission, err := env.service.CompleteTask(context.Background(), testUserID, testTaskID, nil)
+		if err != nil {
+			t.Fatalf("CompleteTask() error = %v", err)
+		}
+		submissions = append(submissions, submission)
+	}
+
+	for i, wantCount := range []int{1, 0} {
+		_, err := env.service.ReviewSubmission(context.Background(), moderatorID, submissions[i].ID, false, "")
+		if err != nil {
+			t.Fatalf("ReviewSubmission() error = %v", err)
+		}
+		if count := env.db.tasks[testTaskID].CompletionCount; count != wantCount {
+			t.Errorf("completion count after %d rejections = %d, want %d", i+1, count, wantCount)
+		}
+	}
+}
+
+func TestReviewSubmission(t *testing.T) {
+	const otherModeratorID = 3
+
+	tests := []struct {
+		name        string
+		moderatorID int
+		wantErr     error
+		wantPoints  int
+	}{
+		{name: "own submission", moderatorID: testUserID, wantErr: serviceerrors.ErrSelfReview, wantPoints: 0},
+		{name: "other user's submission", moderatorID: otherModeratorID, wantPoints: testReward},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			task := env.db.tasks[testTaskID]
+			task.Verification = models.VerificationManual
+			env.db.tasks[testTaskID] = task
+
+			submission, err := env.service.CompleteTask(context.Background(), testUserID, testTaskID, nil)
+			if err != nil {
+				t.Fatalf("CompleteTask() error = %v", err)
+			}
+
+			_, err = env.service.ReviewSubmission(context.Background(), tt.moderatorID, submission.ID, true, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReviewSubmission() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if points := env.db.users[testUserID].Points; points != tt.wantPoints {
+				t.Errorf("user points = %d, want %d", points, tt.wantPoints)
+			}
+			wantStatus := models.SubmissionApproved
+			if tt.wantErr != nil {
+				wantStatus = models.SubmissionPending
+			}
+			if status := env.db.submissions[0].Status; status != wantStatus {
+				t.Errorf("submission status = %s, want %s", status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestSetReferrer(t *testing.T) {
+	// Referral chain 1 <- 2 <- 3; users 4 and 5 have no referrer. Users
+	// registered in id order, an hour apart.
+	newUsers := func() map[int]models.User {
+		registered := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		users := make(map[int]models.User)
+		for id := 1; id <= 5; id++ {
+			user := models.User{
+				ID:            id,
+				ReferralCode:  "CODE" + strconv.Itoa(id),
+				EmailVerified: true,
+				CreatedAt:     registered.Add(time.Duration(id) * time.Hour),
+			}
+			if id == 2 || id == 3 {
+				referrerID := id - 1
+				user.ReferrerID = &referrerID
+			}
+			users[id] = user
+		}
+		return users
+	}
+
+	tests := []struct {
+		name         string
+		userID       int
+		code         string
+		wantErr      error
+		wantReferrer int
+	}{
+		{name: "valid", userID: 5, code: " code4 ", wantReferrer: 4},
+		{name: "self", userID: 4, code: "CODE4", wantErr: serviceerrors.ErrSelfReferral},
+		{name: "direct cycle", userID: 1, code: "CODE2", wantErr: serviceerrors.ErrReferralCycle},
+		{name: "indirect cycle", userID: 1, code: "CODE3", wantErr: serviceerrors.ErrReferralCycle},
+		{name: "referrer registered later", userID: 4, code: "CODE5", wantErr: serviceerrors.ErrReferrerTooNew},
+		{name: "already set", userID: 2, code: "CODE4", wantErr: serviceerrors.ErrReferrerAlreadySet},
+		{name: "unknown code", userID: 5, code: "NOPE", wantErr: serviceerrors.ErrReferrerNotFound},
+		{name: "empty code", userID: 5, code: " ", wantErr: serviceerrors.ErrInvalidCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			env.db.users = newUsers()
+			before := env.db.users[tt.userID].ReferrerID
+
+			err := env.service.SetReferrer(context.Background(), tt.userID, tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetReferrer() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got := env.db.users[tt.userID].ReferrerID
+			if tt.wantErr != nil {
+				if got != before {
+					t.Errorf("referrer changed on error")
+				}
+				return
+			}
+			if got == nil || *got != tt.wantReferrer {
+				t.Errorf("referrer = %v, want %d", got, tt.wantReferrer)
+			}
+		})
+	}
+}
+
+// lastVerifyToken returns the token in the last verification link mailed to
+// address.
+func lastVerifyToken(t *testing.T, env *testEnv, address string) string {
+	t.Helper()
+
+	for i := len(env.mailer.sent) - 1; i >= 0; i-- {
+		msg := env.mailer.sent[i]
+		if msg.To != address {
+			continue
+		}
+		for _, line := range strings.Split(msg.Body, "\n") {
+			if escaped, ok := strings.CutPrefix(line, testVerifyURL); ok {
+				token, err := url.QueryUnescape(escaped)
+				if err != nil {
+					t.Fatalf("failed to unescape token: %v", err)
+				}
+				return token
+			}
+		}
+	}
+	t.Fatalf("no verification link sent to %s", address)
+	return ""
+}
+
+func newEmailTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	env := newTestEnv()
+	user := env.db.users[testUserID]
+	user.Email, user.HashPassword = "old@example.com", hash
+	env.db.users[testUserID] = user
+	return env
+}
+
+func TestEmailChangeKeepsOnlyNewestLink(t *testing.T) {
+	env := newEmailTestEnv(t)
+	ctx := context.Background()
+
+	for _, address := range []string{"first@example.com", "second@example.com"} {
+		err := env.service.RequestEmailChange(ctx, testUserID, address, "password")
+		if err != nil {
+			t.Fatalf("RequestEmailChange(%s) error = %v", address, err)
+		}
+	}
+	first := lastVerifyToken(t, env, "first@example.com")
+	second := lastVerifyToken(t, env, "second@example.com")
+
+	err := env.service.VerifyEmail(ctx, first)
+	if !errors.Is(err, serviceerrors.ErrInvalidVerifyToken) {
+		t.Fatalf("VerifyEmail(older link) error = %v, want %v", err, serviceerrors.ErrInvalidVerifyToken)
+	}
+	if email := env.db.users[testUserID].Email; email != "old@example.com" {
+		t.Fatalf("email after older link = %s, want old@example.com", email)
+	}
+
+	err = env.service.VerifyEmail(ctx, second)
+	if err != nil {
+		t.Fatalf("VerifyEmail(newest link) error = %v", err)
+	}
+	if email := env.db.users[testUserID].Email; email != "second@example.com" {
+		t.Errorf("email = %s, want second@example.com", email)
+	}
+	if n := env.sessions.revoked[testUserID]; n != 1 {
+		t.Errorf("RevokeAll calls = %d, want 1", n)
+	}
+}
+
+func TestVerifyEmailInvalidatesOtherLinks(t *testing.T) {
+	env := newEmailTestEnv(t)
+	ctx := context.Background()
+
+	err := env.service.RequestEmailChange(ctx, testUserID, "new@example.com", "password")
+	if err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	// A link to an older address that is still pending, as if both were
+	// requested at the same time.
+	env.db.verifications = append(env.db.verifications, models.EmailVerification{
+		ID:        99,
+		UserID:    testUserID,
+		Email:     "stale@example.com",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	err = env.service.VerifyEmail(ctx, lastVerifyToken(t, env, "new@example.com"))
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	for _, verification := range env.db.verifications {
+		if verification.UsedAt == nil {
+			t.Errorf("verification %d for %s still pending", verification.ID, verification.Email)
+		}
+	}
+}
+
+func TestVerifyEmailKeepsSessionsForSameAddress(t *testing.T) {
+	env := newEmailTestEnv(t)
+	ctx := context.Background()
+	user := env.db.users[testUserID]
+	user.EmailVerified = false
+	env.db.users[testUserID] = user
+
+	err := env.service.ResendVerification(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("ResendVerification() error = %v", err)
+	}
+	err = env.service.VerifyEmail(ctx, lastVerifyToken(t, env, "old@example.com"))
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+
+	if !env.db.users[testUserID].EmailVerified {
+		t.Error("email not verified")
+	}
+	if n := env.sessions.revoked[testUserID]; n != 0 {
+		t.Errorf("RevokeAll calls = %d, want 0", n)
+	}
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/repository"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/dorik33/DeNet/internal/service"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+	"github.com/dorik33/DeNet/internal/utills"
+	"github.com/dorik33/DeNet/internal/webhook"
+)
+
+// maxExternalIDLength bounds user references sent by partners.
+const maxExternalIDLength = 255
+
+type webhookService struct {
+	webhookRepo repository.WebhookRepository
+	userService service.UserService
+	txManager   repository.TxManager
+	log         *slog.Logger
+	cfg         *config.Config
+}
+
+func NewWebhookService(
+	webhookRepo repository.WebhookRepository,
+	userService service.UserService,
+	txManager repository.TxManager,
+	log *slog.Logger,
+	cfg *config.Config,
+) service.WebhookService {
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		userService: userService,
+		txManager:   txManager,
+		log:         log,
+		cfg:         cfg,
+	}
+}
+
+func (service *webhookService) VerifySignature(provider string, timestamp string, signature string, body []byte) error {
+	secret, ok := service.cfg.WebhookCfg.Secrets[provider]
+	if !ok || secret == "" {
+		return serviceerrors.ErrUnknownProvider
+	}
+
+	err := webhook.Verify([]byte(secret), timestamp, signature, body, time.Now(), service.cfg.WebhookCfg.Tolerance)
+	if err != nil {
+		service.log.Warn("Webhook rejected", slog.String("provider", provider), slog.String("error", err.Error()))
+		return serviceerrors.ErrInvalidSignature
+	}
+	return nil
+}
+
+// ConfirmTask completes the task for the user linked to req.UserRef. The
+// event is recorded in the same transaction as the completion, so a failed
+// completion can be redelivered while a duplicate delivery is rejected with
+// ErrEventProcessed.
+func (service *webhookService) ConfirmTask(ctx context.Context, provider string, req models.WebhookTaskRequest) (*models.WebhookEvent, error) {
+	if req.EventID == "" || req.UserRef == "" || req.TaskID == 0 {
+		return nil, serviceerrors.ErrInvalidEvent
+	}
+
+	event := models.WebhookEvent{
+		Provider: provider,
+		EventID:  req.EventID,
+		TaskID:   req.TaskID,
+	}
+	err := service.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		userID, err := service.webhookRepo.GetLinkedUserID(ctx, provider, req.UserRef)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user: %w", err)
+		}
+		event.UserID = userID
+
+		err = service.webhookRepo.RecordEvent(ctx, &event)
+		if err != nil {
+			return fmt.Errorf("failed to record event: %w", err)
+		}
+
+		_, err = service.userService.ConfirmTask(ctx, provider, userID, req.TaskID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrEventExists) {
+			return nil, serviceerrors.ErrEventProcessed
+		}
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return nil, serviceerrors.ErrUserNotFound
+		}
+		if errors.Is(err, storeerrors.ErrTaskNotFound) {
+			return nil, serviceerrors.ErrTaskNotFound
+		}
+		return nil, err
+	}
+
+	service.log.Info("Webhook event successfully processed",
+		slog.String("provider", provider),
+		slog.String("eventID", event.EventID),
+		slog.Int("userID", event.UserID),
+		slog.Int("taskID", event.TaskID))
+	return &event, nil
+}
+
+// IssueLinkToken returns a short-lived token naming the user and the
+// provider. The user hands it to the partner, which sends it back with its
+// own account id in a signed callback, so neither side can claim the
+// other's account on its own.
+func (service *webhookService) IssueLinkToken(ctx context.Context, userID int, provider string) (*models.LinkToken, error) {
+	if _, ok := service.cfg.WebhookCfg.Secrets[provider]; !ok {
+		return nil, serviceerrors.ErrUnknownProvider
+	}
+
+	expiresAt := time.Now().UTC().Add(service.cfg.WebhookCfg.LinkTTL).Truncate(time.Second)
+	payload := strconv.Itoa(userID) + "." + strconv.FormatInt(expiresAt.Unix(), 10) + "." + provider
+
+	service.log.Info("Link token successfully issued", slog.Int("userID", userID), slog.String("provider", provider))
+	return &models.LinkToken{
+		LinkToken: utills.SignToken([]byte(service.cfg.WebhookCfg.LinkSecret), payload),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// LinkAccount links the partner account in req to the user named by the
+// link token. The request must come from a signed partner callback.
+func (service *webhookService) LinkAccount(ctx context.Context, provider string, req models.WebhookAccountRequest) error {
+	externalID := strings.TrimSpace(req.ExternalID)
+	if externalID == "" || len(externalID) > maxExternalIDLength {
+		return serviceerrors.ErrInvalidAccount
+	}
+
+	payload, err := utills.VerifySignedToken([]byte(service.cfg.WebhookCfg.LinkSecret), req.LinkToken)
+	if err != nil {
+		return serviceerrors.ErrInvalidLinkToken
+	}
+	parts := strings.SplitN(payload, ".", 3)
+	if len(parts) != 3 || parts[2] != provider {
+		return serviceerrors.ErrInvalidLinkToken
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return serviceerrors.ErrInvalidLinkToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return serviceerrors.ErrInvalidLinkToken
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return serviceerrors.ErrLinkTokenExpired
+	}
+
+	err = service.webhookRepo.LinkAccount(ctx, provider, externalID, userID)
+	if err != nil {
+		if errors.Is(err, storeerrors.ErrAccountLinked) {
+			return serviceerrors.ErrAccountLinked
+		}
+		if errors.Is(err, storeerrors.ErrUserNotFound) {
+			return serviceerrors.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to link account: %w", err)
+	}
+
+	service.log.Info("Account successfully linked", slog.Int("userID", userID), slog.String("provider", provider))
+	return nil
+}
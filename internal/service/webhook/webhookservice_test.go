@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/dorik33/DeNet/internal/models"
+	storeerrors "github.com/dorik33/DeNet/internal/repository/storeErorrs"
+	"github.com/dorik33/DeNet/internal/service"
+	"github.com/dorik33/DeNet/internal/service/serviceerrors"
+)
+
+const (
+	testProvider = "partner"
+	testUserID   = 7
+	testTaskID   = 10
+)
+
+// fakeWebhookRepo keeps linked accounts and recorded events in maps.
+// fakeTxManager drops events recorded by a transaction that fails.
+type fakeWebhookRepo struct {
+	links  map[string]int
+	events map[string]bool
+}
+
+func (repo *fakeWebhookRepo) LinkAccount(ctx context.Context, provider string, externalID string, userID int) error {
+	if _, ok := repo.links[provider+"/"+externalID]; ok {
+		return storeerrors.ErrAccountLinked
+	}
+	repo.links[provider+"/"+externalID] = userID
+	return nil
+}
+
+func (repo *fakeWebhookRepo) GetLinkedUserID(ctx context.Context, provider string, externalID string) (int, error) {
+	userID, ok := repo.links[provider+"/"+externalID]
+	if !ok {
+		return 0, storeerrors.ErrUserNotFound
+	}
+	return userID, nil
+}
+
+func (repo *fakeWebhookRepo) RecordEvent(ctx context.Context, event *models.WebhookEvent) error {
+	if repo.events[event.Provider+"/"+event.EventID] {
+		return storeerrors.ErrEventExists
+	}
+	repo.events[event.Provider+"/"+event.EventID] = true
+	return nil
+}
+
+type fakeTxManager struct {
+	repo *fakeWebhookRepo
+}
+
+func (m *fakeTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	snapshot := maps.Clone(m.repo.events)
+	err := fn(ctx)
+	if err != nil {
+		m.repo.events = snapshot
+	}
+	return err
+}
+
+func (m *fakeTxManager) AfterCommit(ctx context.Context, fn func()) {
+	fn()
+}
+
+// fakeUserService counts the completions confirmed through it. Calling any
+// other method panics.
+type fakeUserService struct {
+	service.UserService
+	confirmed int
+	err       error
+}
+
+func (s *fakeUserService) ConfirmTask(ctx context.Context, provider string, userID int, taskID int) (*models.Submission, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.confirmed++
+	return &models.Submission{UserID: userID, TaskID: taskID}, nil
+}
+
+func newTestService(linkTTL time.Duration) (service.WebhookService, *fakeWebhookRepo, *fakeUserService) {
+	repo := &fakeWebhookRepo{
+		links:  map[string]int{testProvider + "/ext-1": testUserID},
+		events: make(map[string]bool),
+	}
+	users := &fakeUserService{}
+
+	cfg := &config.Config{}
+	cfg.WebhookCfg.Secrets = map[string]string{testProvider: "secret"}
+	cfg.WebhookCfg.LinkSecret = "link-secret"
+	cfg.WebhookCfg.LinkTTL = linkTTL
+
+	return NewWebhookService(repo, users, &fakeTxManager{repo: repo}, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg), repo, users
+}
+
+func TestConfirmTaskRejectsReplayedEvent(t *testing.T) {
+	svc, _, users := newTestService(time.Minute)
+	req := models.WebhookTaskRequest{EventID: "evt-1", UserRef: "ext-1", TaskID: testTaskID}
+
+	_, err := svc.ConfirmTask(context.Background(), testProvider, req)
+	if err != nil {
+		t.Fatalf("first delivery: ConfirmTask() error = %v", err)
+	}
+	_, err = svc.ConfirmTask(context.Background(), testProvider, req)
+	if !errors.Is(err, serviceerrors.ErrEventProcessed) {
+		t.Fatalf("replay: ConfirmTask() error = %v, want %v", err, serviceerrors.ErrEventProcessed)
+	}
+	if users.confirmed != 1 {
+		t.Errorf("completions confirmed = %d, want 1", users.confirmed)
+	}
+}
+
+func TestConfirmTaskAllowsRedeliveryAfterFailure(t *testing.T) {
+	svc, _, users := newTestService(time.Minute)
+	req := models.WebhookTaskRequest{EventID: "evt-1", UserRef: "ext-1", TaskID: testTaskID}
+
+	users.err = serviceerrors.ErrTaskCapReached
+	_, err := svc.ConfirmTask(context.Background(), testProvider, req)
+	if !errors.Is(err, serviceerrors.ErrTaskCapReached) {
+		t.Fatalf("failed delivery: ConfirmTask() error = %v, want %v", err, serviceerrors.ErrTaskCapReached)
+	}
+
+	users.err = nil
+	_, err = svc.ConfirmTask(context.Background(), testProvider, req)
+	if err != nil {
+		t.Fatalf("redelivery: ConfirmTask() error = %v", err)
+	}
+	if users.confirmed != 1 {
+		t.Errorf("completions confirmed = %d, want 1", users.confirmed)
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		linkTTL  time.Duration
+		provider string
+		token    func(token string) string
+		wantErr  error
+	}{
+		{name: "valid", linkTTL: time.Minute, provider: testProvider, token: func(token string) string { return token }},
+		{name: "expired", linkTTL: -time.Minute, provider: testProvider, token: func(token string) string { return token }, wantErr: serviceerrors.ErrLinkTokenExpired},
+		{name: "other provider", linkTTL: time.Minute, provider: "other", token: func(token string) string { return token }, wantErr: serviceerrors.ErrInvalidLinkToken},
+		{
+			name:     "other user",
+			linkTTL:  time.Minute,
+			provider: testProvider,
+			token:    func(token string) string { return "8" + strings.TrimPrefix(token, "7") },
+			wantErr:  serviceerrors.ErrInvalidLinkToken,
+		},
+		{name: "forged", linkTTL: time.Minute, provider: testProvider, token: func(string) string { return "7.9999999999.partner.c2lnbmF0dXJl" }, wantErr: serviceerrors.ErrInvalidLinkToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, _ := newTestService(tt.linkTTL)
+			issued, err := svc.IssueLinkToken(context.Background(), testUserID, testProvider)
+			if err != nil {
+				t.Fatalf("IssueLinkToken() error = %v", err)
+			}
+
+			req := models.WebhookAccountRequest{LinkToken: tt.token(issued.LinkToken), ExternalID: "ext-2"}
+			err = svc.LinkAccount(context.Background(), tt.provider, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LinkAccount() error = %v, want %v", err, tt.wantErr)
+			}
+
+			userID, linked := repo.links[tt.provider+"/ext-2"]
+			if linked != (tt.wantErr == nil) || (linked && userID != testUserID) {
+				t.Errorf("linked = %v to user %d, want linked = %v to user %d", linked, userID, tt.wantErr == nil, testUserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single JWT key. Private is nil for keys that are only used to
+// verify tokens signed before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private any
+	Public  any
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are
+// still accepted from. Tokens carry the key id in the "kid" header.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet builds the key set from the config. HS256 keeps using
+// JWT_SECRET_KEY; RS256 and EdDSA read the private key from a PEM file.
+// Public keys listed in JWT_VERIFY_KEYS stay valid for verification only.
+func LoadKeySet(cfg *config.Config) (*KeySet, error) {
+	signing := &Key{ID: cfg.SigningCfg.KeyID}
+
+	switch cfg.SigningCfg.Algorithm {
+	case "", jwt.SigningMethodHS256.Alg():
+		if cfg.SecretKey == "" {
+			return nil, errors.New("JWT_SECRET_KEY is required for HS256")
+		}
+		signing.Method = jwt.SigningMethodHS256
+		signing.Private = []byte(cfg.SecretKey)
+		signing.Public = []byte(cfg.SecretKey)
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		private, err := readPrivateKey(cfg.SigningCfg.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		switch key := private.(type) {
+		case *rsa.PrivateKey:
+			signing.Method = jwt.SigningMethodRS256
+			signing.Public = &key.PublicKey
+		case ed25519.PrivateKey:
+			signing.Method = jwt.SigningMethodEdDSA
+			signing.Public = key.Public()
+		}
+		if signing.Method.Alg() != cfg.SigningCfg.Algorithm {
+			return nil, fmt.Errorf("private key does not match algorithm %s", cfg.SigningCfg.Algorithm)
+		}
+		signing.Private = private
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.SigningCfg.Algorithm)
+	}
+
+	if signing.ID == "" {
+		return nil, errors.New("JWT_SIGNING_KEY_ID is required")
+	}
+
+	ks := &KeySet{
+		signing: signing,
+		keys:    map[string]*Key{signing.ID: signing},
+	}
+
+	for kid, path := range cfg.SigningCfg.VerifyKeys {
+		if _, ok := ks.keys[kid]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", kid)
+		}
+		key, err := readPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[kid] = key
+	}
+
+	return ks, nil
+}
+
+// Sign signs the claims with the current signing key.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Private)
+}
+
+// Keyfunc resolves the verification key for a parsed token. Tokens without a
+// kid predate key ids and are only accepted by an HMAC signing key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	key := ks.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	} else if _, ok := key.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.New("token has no key id")
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. Symmetric keys are
+// never published.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (any, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+func readPublicKey(kid string, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var public any
+	if block.Type == "RSA PUBLIC KEY" {
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %q: %w", kid, err)
+	}
+
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: public}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: public}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T for %q", public, kid)
+}
@@ -0,0 +1,104 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dorik33/DeNet/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestKeyfunc(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	rsaPublicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	edPublicDER, _ := x509.MarshalPKIXPublicKey(edPublic)
+
+	hmacCfg := &config.Config{SecretKey: "secret"}
+	hmacCfg.SigningCfg.KeyID = "hmac"
+	hmacKeys, err := LoadKeySet(hmacCfg)
+	if err != nil {
+		t.Fatalf("LoadKeySet(HS256) error = %v", err)
+	}
+
+	// RS256 signs new tokens; the Ed25519 key was rotated out and only
+	// verifies old ones.
+	rsaCfg := &config.Config{}
+	rsaCfg.SigningCfg.Algorithm = "RS256"
+	rsaCfg.SigningCfg.KeyID = "rsa"
+	rsaCfg.SigningCfg.PrivateKeyPath = writePEM(t, "PRIVATE KEY", rsaDER)
+	rsaCfg.SigningCfg.VerifyKeys = map[string]string{"old": writePEM(t, "PUBLIC KEY", edPublicDER)}
+	rsaKeys, err := LoadKeySet(rsaCfg)
+	if err != nil {
+		t.Fatalf("LoadKeySet(RS256) error = %v", err)
+	}
+
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDER})
+
+	tests := []struct {
+		name    string
+		keys    *KeySet
+		token   string
+		wantErr bool
+	}{
+		{name: "HS256", keys: hmacKeys, token: sign(t, jwt.SigningMethodHS256, "hmac", []byte("secret"))},
+		{name: "HS256 without kid", keys: hmacKeys, token: sign(t, jwt.SigningMethodHS256, "", []byte("secret"))},
+		{name: "HS256 wrong secret", keys: hmacKeys, token: sign(t, jwt.SigningMethodHS256, "hmac", []byte("other")), wantErr: true},
+		{name: "HS384 for an HS256 key", keys: hmacKeys, token: sign(t, jwt.SigningMethodHS384, "hmac", []byte("secret")), wantErr: true},
+		{name: "RS256", keys: rsaKeys, token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey)},
+		{name: "rotated EdDSA key", keys: rsaKeys, token: sign(t, jwt.SigningMethodEdDSA, "old", edKey)},
+		{name: "HS256 signed with the RSA public key", keys: rsaKeys, token: sign(t, jwt.SigningMethodHS256, "rsa", publicPEM), wantErr: true},
+		{name: "RS256 under the EdDSA kid", keys: rsaKeys, token: sign(t, jwt.SigningMethodRS256, "old", rsaKey), wantErr: true},
+		{name: "RS256 without kid", keys: rsaKeys, token: sign(t, jwt.SigningMethodRS256, "", rsaKey), wantErr: true},
+		{name: "unknown kid", keys: rsaKeys, token: sign(t, jwt.SigningMethodRS256, "gone", rsaKey), wantErr: true},
+		{name: "alg none", keys: rsaKeys, token: sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, tt.keys.Keyfunc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, want error = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
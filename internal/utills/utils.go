@@ -1,64 +1,155 @@
 package utills
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dorik33/DeNet/internal/models"
+	"github.com/dorik33/DeNet/internal/signing"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+func init() {
+	// Issue times are compared against the per-user revocation watermark, so
+	// whole seconds are too coarse: a token issued right after "revoke all"
+	// would otherwise look as old as the ones it replaced.
+	jwt.TimePrecision = time.Millisecond
+}
+
+// TokenWatermark rounds t down to the precision of token issue times. A
+// revocation watermark compared against iat must be rounded the same way,
+// otherwise a token issued in the same millisecond right after revoking
+// would look older than the watermark.
+func TokenWatermark(t time.Time) time.Time {
+	return t.UTC().Truncate(jwt.TimePrecision)
+}
+
 func VerifyPassword(storedPassword, providedPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(providedPassword))
 }
-func GenerateToken(id int, email string, secretKey []byte, duration time.Duration) (string, error) {
+
+// GenerateToken signs an access token for the user. The user id is carried in
+// the subject and every token gets its own random id (jti) so that it can be
+// revoked individually.
+func GenerateToken(user *models.User, keys *signing.KeySet, duration time.Duration) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := models.UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			ID:        strconv.Itoa(id),
+			Subject:   strconv.Itoa(user.ID),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
 		},
-		Email: email,
+		Email: user.Email,
+		Role:  user.Role,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString(secretKey)
+	return keys.Sign(claims)
 }
 
-func ValidateToken(tokenStr string, secretKey []byte) (int, error) {
+func ValidateToken(tokenStr string, keys *signing.KeySet) (*models.UserClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		tokenStr,
 		&models.UserClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return secretKey, nil
-		},
+		keys.Keyfunc,
 	)
 
 	if err != nil {
-		return 0, fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
 	if !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	claims, ok := token.Claims.(*models.UserClaims)
 	if !ok {
-		return 0, fmt.Errorf("invalid token claims")
+		return nil, fmt.Errorf("invalid token claims")
 	}
 
 	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
-		return 0, fmt.Errorf("token expired")
+		return nil, fmt.Errorf("token expired")
 	}
 
-	userID, err := strconv.Atoi(claims.ID)
-	if err != nil {
-		return 0, fmt.Errorf("invalid user ID in token")
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("token has no id")
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("invalid user ID in token")
+	}
+
+	return claims, nil
+}
+
+// RandomToken returns size bytes of crypto/rand output encoded as URL-safe
+// base64.
+func RandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token. Only hashes of
+// refresh tokens are persisted.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	return userID, nil
+// SignToken appends the HMAC-SHA256 of payload under secret, so that the
+// payload can be trusted when the token comes back.
+func SignToken(secret []byte, payload string) string {
+	return payload + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(secret, payload))
+}
+
+// VerifySignedToken returns the payload of a token made by SignToken.
+func VerifySignedToken(secret []byte, token string) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", errors.New("malformed signed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, tokenMAC(secret, token[:i])) {
+		return "", errors.New("invalid token signature")
+	}
+	return token[:i], nil
+}
+
+func tokenMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// referralAlphabet leaves out characters that are easy to confuse when a code
+// is read aloud or typed from a screenshot (0/O, 1/I/L).
+const referralAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// ReferralCode returns a random code of the given length.
+func ReferralCode(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	for i := range b {
+		b[i] = referralAlphabet[int(b[i])%len(referralAlphabet)]
+	}
+	return string(b), nil
 }
@@ -0,0 +1,42 @@
+package utills
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifySignedToken(t *testing.T) {
+	secret := []byte("secret")
+	token := SignToken(secret, "42.1800000000")
+	sig := token[strings.LastIndexByte(token, '.')+1:]
+
+	tests := []struct {
+		name        string
+		secret      []byte
+		token       string
+		wantPayload string
+		wantErr     bool
+	}{
+		{name: "valid", secret: secret, token: token, wantPayload: "42.1800000000"},
+		{name: "dots in payload", secret: secret, token: SignToken(secret, "7.1800000000.partner"), wantPayload: "7.1800000000.partner"},
+		{name: "wrong secret", secret: []byte("other"), token: token, wantErr: true},
+		{name: "changed payload", secret: secret, token: "43.1800000000." + sig, wantErr: true},
+		{name: "changed expiry", secret: secret, token: "42.1900000000." + sig, wantErr: true},
+		{name: "truncated signature", secret: secret, token: token[:len(token)-2], wantErr: true},
+		{name: "signature not base64", secret: secret, token: "42.1800000000.!!!", wantErr: true},
+		{name: "no signature", secret: secret, token: "42", wantErr: true},
+		{name: "empty", secret: secret, token: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := VerifySignedToken(tt.secret, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifySignedToken() error = %v, want error = %v", err, tt.wantErr)
+			}
+			if payload != tt.wantPayload {
+				t.Errorf("VerifySignedToken() payload = %q, want %q", payload, tt.wantPayload)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"event_id":"1"}`)
+	now := time.Unix(1_800_000_000, 0)
+	sentAt := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+	ts := sentAt(0)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   error
+	}{
+		{name: "valid", timestamp: ts, signature: Sign(secret, ts, body), body: body},
+		{name: "edge of window in the past", timestamp: sentAt(-5 * time.Minute), signature: Sign(secret, sentAt(-5*time.Minute), body), body: body},
+		{name: "edge of window in the future", timestamp: sentAt(5 * time.Minute), signature: Sign(secret, sentAt(5*time.Minute), body), body: body},
+		{name: "too old", timestamp: sentAt(-6 * time.Minute), signature: Sign(secret, sentAt(-6*time.Minute), body), body: body, wantErr: ErrStaleTimestamp},
+		{name: "too far in the future", timestamp: sentAt(6 * time.Minute), signature: Sign(secret, sentAt(6*time.Minute), body), body: body, wantErr: ErrStaleTimestamp},
+		{name: "wrong secret", timestamp: ts, signature: Sign([]byte("other"), ts, body), body: body, wantErr: ErrInvalidSignature},
+		{name: "tampered body", timestamp: ts, signature: Sign(secret, ts, body), body: []byte(`{"event_id":"2"}`), wantErr: ErrInvalidSignature},
+		{name: "timestamp not signed", timestamp: sentAt(time.Minute), signature: Sign(secret, ts, body), body: body, wantErr: ErrInvalidSignature},
+		{name: "missing prefix", timestamp: ts, signature: Sign(secret, ts, body)[len(signaturePrefix):], body: body, wantErr: ErrInvalidSignature},
+		{name: "malformed timestamp", timestamp: "yesterday", signature: Sign(secret, "yesterday", body), body: body, wantErr: ErrInvalidSignature},
+		{name: "empty signature", timestamp: ts, signature: "", body: body, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.timestamp, tt.signature, tt.body, now, 5*time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
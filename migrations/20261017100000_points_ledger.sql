@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE point_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    delta INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    task_id INTEGER NULL REFERENCES tasks(id),
+    source_user_id INTEGER NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_point_transactions_user_id ON point_transactions (user_id, id DESC);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO point_transactions (user_id, delta, reason)
+SELECT id, points, 'opening_balance'
+FROM users
+WHERE points <> 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS point_transactions;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD COLUMN recurrence TEXT NOT NULL DEFAULT 'once'
+        CONSTRAINT chk_tasks_recurrence CHECK (recurrence IN ('once', 'daily', 'weekly', 'interval')),
+    ADD COLUMN interval_hours INTEGER NULL CONSTRAINT chk_tasks_interval_hours CHECK (interval_hours > 0),
+    ADD COLUMN max_completions INTEGER NULL CONSTRAINT chk_tasks_max_completions CHECK (max_completions > 0),
+    ADD CONSTRAINT chk_tasks_interval CHECK (recurrence <> 'interval' OR interval_hours IS NOT NULL);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks DROP CONSTRAINT user_tasks_pkey;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks ADD COLUMN id BIGSERIAL PRIMARY KEY;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_user_tasks_user_task ON user_tasks (user_id, task_id, completed_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_user_tasks_user_task;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DELETE FROM user_tasks ut
+USING user_tasks earlier
+WHERE ut.user_id = earlier.user_id AND ut.task_id = earlier.task_id AND ut.id > earlier.id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks DROP COLUMN id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks ADD PRIMARY KEY (user_id, task_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS chk_tasks_interval,
+    DROP COLUMN IF EXISTS max_completions,
+    DROP COLUMN IF EXISTS interval_hours,
+    DROP COLUMN IF EXISTS recurrence;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE task_prerequisites (
+    task_id INTEGER NOT NULL REFERENCES tasks(id),
+    required_task_id INTEGER NOT NULL REFERENCES tasks(id),
+    PRIMARY KEY (task_id, required_task_id),
+    CONSTRAINT chk_task_prerequisites_self CHECK (task_id <> required_task_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD COLUMN min_points INTEGER NOT NULL DEFAULT 0
+    CONSTRAINT chk_tasks_min_points CHECK (min_points >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tasks DROP COLUMN IF EXISTS min_points;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS task_prerequisites;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD COLUMN starts_at TIMESTAMP NULL,
+    ADD COLUMN ends_at TIMESTAMP NULL,
+    ADD COLUMN completion_cap INTEGER NULL CONSTRAINT chk_tasks_completion_cap CHECK (completion_cap > 0),
+    ADD COLUMN completion_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN reward_decay_per_day INTEGER NOT NULL DEFAULT 0 CONSTRAINT chk_tasks_reward_decay CHECK (reward_decay_per_day >= 0),
+    ADD COLUMN min_reward INTEGER NOT NULL DEFAULT 0 CONSTRAINT chk_tasks_min_reward CHECK (min_reward >= 0),
+    ADD CONSTRAINT chk_tasks_window CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE tasks t
+SET completion_count = (SELECT COUNT(DISTINCT ut.user_id) FROM user_tasks ut WHERE ut.task_id = t.id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS chk_tasks_window,
+    DROP COLUMN IF EXISTS min_reward,
+    DROP COLUMN IF EXISTS reward_decay_per_day,
+    DROP COLUMN IF EXISTS completion_count,
+    DROP COLUMN IF EXISTS completion_cap,
+    DROP COLUMN IF EXISTS ends_at,
+    DROP COLUMN IF EXISTS starts_at;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD COLUMN verification TEXT NOT NULL DEFAULT 'auto'
+    CONSTRAINT chk_tasks_verification CHECK (verification IN ('auto', 'manual', 'proof'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+        CONSTRAINT chk_user_tasks_status CHECK (status IN ('pending', 'approved', 'rejected')),
+    ADD COLUMN proof_type TEXT NULL CONSTRAINT chk_user_tasks_proof_type CHECK (proof_type IN ('text', 'url', 'file')),
+    ADD COLUMN proof_value TEXT NULL,
+    ADD COLUMN reviewed_by INTEGER NULL REFERENCES users(id),
+    ADD COLUMN reviewed_at TIMESTAMP NULL,
+    ADD COLUMN review_comment TEXT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_user_tasks_pending ON user_tasks (completed_at) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE tasks SET verification = 'manual' WHERE name = 'Тестовое задание DeNet';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_user_tasks_pending;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DELETE FROM user_tasks WHERE status <> 'approved';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE user_tasks
+    DROP COLUMN IF EXISTS review_comment,
+    DROP COLUMN IF EXISTS reviewed_at,
+    DROP COLUMN IF EXISTS reviewed_by,
+    DROP COLUMN IF EXISTS proof_value,
+    DROP COLUMN IF EXISTS proof_type,
+    DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks DROP COLUMN IF EXISTS verification;
+-- +goose StatementEnd
@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tasks DROP CONSTRAINT chk_tasks_verification;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD CONSTRAINT chk_tasks_verification CHECK (verification IN ('auto', 'manual', 'proof', 'webhook')),
+    ADD COLUMN provider TEXT NULL,
+    ADD CONSTRAINT chk_tasks_provider CHECK ((verification = 'webhook') = (provider IS NOT NULL));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE external_accounts (
+    provider TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, external_id),
+    CONSTRAINT uq_external_accounts_user UNIQUE (provider, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE webhook_events (
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES tasks(id),
+    received_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, event_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webhook_events;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS external_accounts;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE tasks SET verification = 'manual' WHERE verification = 'webhook';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS chk_tasks_provider,
+    DROP COLUMN IF EXISTS provider,
+    DROP CONSTRAINT IF EXISTS chk_tasks_verification;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tasks
+    ADD CONSTRAINT chk_tasks_verification CHECK (verification IN ('auto', 'manual', 'proof'));
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN referral_code TEXT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE users SET referral_code = upper(substr(md5(random()::text || id::text), 1, 8));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+    ALTER COLUMN referral_code SET NOT NULL,
+    ADD CONSTRAINT uq_users_referral_code UNIQUE (referral_code);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE users SET referrer_id = NULL WHERE referrer_id = id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Longer cycles are broken at the member with the lowest id. walk follows
+-- each chain upwards until it revisits a user; a user is on a cycle when
+-- its own walk comes back to it, and the path then holds the whole cycle.
+WITH RECURSIVE walk (start_id, id, path) AS (
+    SELECT id, referrer_id, ARRAY[id]
+    FROM users
+    WHERE referrer_id IS NOT NULL
+    UNION ALL
+    SELECT w.start_id, u.referrer_id, w.path || u.id
+    FROM walk w
+    INNER JOIN users u ON u.id = w.id
+    WHERE u.referrer_id IS NOT NULL AND NOT u.id = ANY(w.path)
+)
+UPDATE users
+SET referrer_id = NULL
+WHERE id IN (
+    SELECT (SELECT MIN(member) FROM unnest(path) AS member)
+    FROM walk
+    WHERE id = start_id
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN referred_at TIMESTAMP NULL,
+    ADD CONSTRAINT chk_users_not_self_referred CHECK (referrer_id IS NULL OR referrer_id <> id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE users SET referred_at = created_at WHERE referrer_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_users_referrer ON users (referrer_id) WHERE referrer_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_referrer;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS chk_users_not_self_referred,
+    DROP COLUMN IF EXISTS referred_at;
+-- +goose StatementEnd
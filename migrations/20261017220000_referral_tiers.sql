@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX idx_point_transactions_commission ON point_transactions (user_id, source_user_id)
+    WHERE reason = 'referral_commission';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_point_transactions_commission;
+-- +goose StatementEnd
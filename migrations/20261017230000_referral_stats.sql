@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX idx_users_referrer_referred_at ON users (referrer_id, referred_at) WHERE referrer_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_referrer;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX idx_users_referrer ON users (referrer_id) WHERE referrer_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_referrer_referred_at;
+-- +goose StatementEnd
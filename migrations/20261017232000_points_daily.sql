@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE points_daily (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    day DATE NOT NULL,
+    points INTEGER NOT NULL,
+    PRIMARY KEY (user_id, day)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_points_daily_day ON points_daily (day, user_id) INCLUDE (points);
+-- +goose StatementEnd
+
+-- created_at holds now() in the session time zone; days are cut in UTC to
+-- match the period boundaries computed by the service.
+-- +goose StatementBegin
+INSERT INTO points_daily (user_id, day, points)
+SELECT user_id, (created_at::timestamptz AT TIME ZONE 'UTC')::date, SUM(delta)
+FROM point_transactions
+WHERE reason <> 'opening_balance'
+GROUP BY user_id, (created_at::timestamptz AT TIME ZONE 'UTC')::date;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS points_daily;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NULL,
+    ADD COLUMN avatar_url TEXT NULL,
+    ADD COLUMN hide_from_leaderboard BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX idx_users_display_name ON users (LOWER(display_name)) WHERE display_name IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_points;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_users_points ON users (points DESC, id) WHERE NOT hide_from_leaderboard;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_points;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_users_points ON users (points DESC, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_display_name;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS hide_from_leaderboard,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS display_name;
+-- +goose StatementEnd